@@ -2,15 +2,20 @@ package acmogo
 
 import (
 	"errors"
+	"time"
 )
 
 var (
-	ACPath       = "_ac"
-	PublicPath   = ACPath + ".pu"
-	ReadersPath  = ACPath + ".r"
-	UpdatersPath = ACPath + ".u"
-	DeletersPath = ACPath + ".d"
-	CreatorPath  = ACPath + ".cr"
+	ACPath        = "_ac"
+	PublicPath    = ACPath + ".pu"
+	ReadersPath   = ACPath + ".r"
+	UpdatersPath  = ACPath + ".u"
+	DeletersPath  = ACPath + ".d"
+	CreatorPath   = ACPath + ".cr"
+	GrantsPath    = ACPath + ".g"
+	TimedPath     = ACPath + ".t"
+	DeniedPath    = ACPath + ".dn"
+	NoInheritPath = ACPath + ".ni"
 )
 
 // AC should be Embeded in structs to be stored in MongoDB
@@ -23,6 +28,19 @@ type AC struct {
 	Deleters []Reference `json:"d,omitempty" bson:"d,omitempty"`
 	Creator  *Reference  `json:"cr,omitempty" bson:"cr,omitempty"`
 	Public   bool        `json:"pu" bson:"pu"`
+
+	// Grants holds the references granted registered permissions
+	// other than Read, Update and Delete.
+	Grants map[Permission][]Reference `json:"g,omitempty" bson:"g,omitempty"`
+
+	// Timed holds grants that are only in effect for a period of time.
+	Timed []Grant `json:"t,omitempty" bson:"t,omitempty"`
+
+	// Denied references hold no permission at all, whatever they are granted.
+	Denied []Reference `json:"dn,omitempty" bson:"dn,omitempty"`
+
+	// NoInherit stops the AC of the parent entity being merged into this one.
+	NoInherit bool `json:"ni,omitempty" bson:"ni,omitempty"`
 }
 
 func (ac *AC) SetCreator(id Reference) error {
@@ -37,109 +55,126 @@ func (ac *AC) SetCreator(id Reference) error {
 }
 
 func (ac AC) ReadPermitted(refs ...Referencer) bool {
-	if ac.Public {
-		return true
-	}
-	for _, ref := range refs {
-		id := ref.Ref()
-		if ac.Creator != nil && ac.Creator.Col == id.Col && ac.Creator.ID == id.ID {
-			return true
-		}
-
-		for _, idInSet := range ac.Deleters {
-			if idInSet.Col == id.Col && idInSet.ID == id.ID {
-				return true
-			}
-		}
-		for _, idInSet := range ac.Updaters {
-			if idInSet.Col == id.Col && idInSet.ID == id.ID {
-				return true
-			}
-		}
-		for _, idInSet := range ac.Readers {
-			if idInSet.Col == id.Col && idInSet.ID == id.ID {
-				return true
-			}
-		}
-	}
-	return false
+	return ac.Permitted(Read, refs...)
 }
 
 func (ac AC) UpdatePermitted(refs ...Referencer) bool {
-	for _, ref := range refs {
-		id := ref.Ref()
-		if ac.Creator != nil && ac.Creator.Col == id.Col && ac.Creator.ID == id.ID {
-			return true
-		}
+	return ac.Permitted(Update, refs...)
+}
 
-		for _, idInSet := range ac.Deleters {
-			if idInSet.Col == id.Col && idInSet.ID == id.ID {
-				return true
-			}
+func (ac AC) DeletePermitted(refs ...Referencer) bool {
+	return ac.Permitted(Delete, refs...)
+}
+
+// Permitted reports whether any of refs holds perm. The creator holds
+// every permission and Public grants Read to everyone, unless one of
+// refs is denied. Timed grants are evaluated at Now().
+func (ac AC) Permitted(perm Permission, refs ...Referencer) bool {
+	return ac.PermittedAt(perm, Now(), refs...)
+}
+
+// PermittedAt is like Permitted but evaluates timed grants at t.
+func (ac AC) PermittedAt(perm Permission, t time.Time, refs ...Referencer) bool {
+	return ac.ExplainAt(perm, t, refs...).Permitted
+}
+
+// References returns the references granted perm directly.
+func (ac AC) References(perm Permission) []Reference {
+	switch perm {
+	case Read:
+		return ac.Readers
+	case Update:
+		return ac.Updaters
+	case Delete:
+		return ac.Deleters
+	}
+	return ac.Grants[perm]
+}
+
+func (ac *AC) setReferences(perm Permission, refs []Reference) {
+	switch perm {
+	case Read:
+		ac.Readers = refs
+	case Update:
+		ac.Updaters = refs
+	case Delete:
+		ac.Deleters = refs
+	default:
+		if len(refs) == 0 {
+			delete(ac.Grants, perm)
+			return
 		}
-		for _, idInSet := range ac.Updaters {
-			if idInSet.Col == id.Col && idInSet.ID == id.ID {
-				return true
-			}
+		if ac.Grants == nil {
+			ac.Grants = make(map[Permission][]Reference)
 		}
+		ac.Grants[perm] = refs
 	}
-	return false
 }
 
-func (ac AC) DeletePermitted(refs ...Referencer) bool {
+func (ac *AC) ClearAccessControl(refs ...Referencer) {
 	for _, ref := range refs {
-		id := ref.Ref()
-		if ac.Creator != nil && ac.Creator.Col == id.Col && ac.Creator.ID == id.ID {
-			return true
+		r := ref.Ref()
+		for _, perm := range Permissions() {
+			ac.setReferences(perm, FilterReferenceList(ac.References(perm), r))
 		}
-
-		for _, idInSet := range ac.Deleters {
-			if idInSet.Col == id.Col && idInSet.ID == id.ID {
-				return true
+		timed := ac.Timed[:0]
+		for _, grant := range ac.Timed {
+			if grant.Ref.Col != r.Col || grant.Ref.ID != r.ID {
+				timed = append(timed, grant)
 			}
 		}
+		ac.Timed = timed
 	}
-	return false
 }
 
-func (ac *AC) ClearAccessControl(refs ...Referencer) {
+// Permit grants perm to refs replacing any permission they held before.
+func (ac *AC) Permit(perm Permission, refs ...Referencer) error {
+	if !perm.Registered() {
+		return ErrUnknownPermission
+	}
 	for _, ref := range refs {
-		r := ref.Ref()
-		ac.Updaters = FilterReferenceList(ac.Updaters, r)
-		ac.Deleters = FilterReferenceList(ac.Deleters, r)
-		ac.Readers = FilterReferenceList(ac.Readers, r)
+		ac.ClearAccessControl(ref)
+		ac.setReferences(perm, append(ac.References(perm), ref.Ref()))
 	}
+	return nil
 }
 
 func (ac *AC) PermitRead(refs ...Referencer) {
-	for _, ref := range refs {
-		r := ref.Ref()
-		ac.Updaters = FilterReferenceList(ac.Updaters, r)
-		ac.Deleters = FilterReferenceList(ac.Deleters, r)
-		ac.Readers = FilterReferenceList(ac.Readers, r)
-
-		ac.Readers = append(ac.Readers, r)
-	}
+	ac.Permit(Read, refs...)
 }
 
 func (ac *AC) PermitUpdate(refs ...Referencer) {
+	ac.Permit(Update, refs...)
+}
+
+func (ac *AC) PermitDelete(refs ...Referencer) {
+	ac.Permit(Delete, refs...)
+}
+
+// Deny blocks refs from every permission, overriding any grant.
+func (ac *AC) Deny(refs ...Referencer) {
 	for _, ref := range refs {
 		r := ref.Ref()
-		ac.Updaters = FilterReferenceList(ac.Updaters, r)
-		ac.Deleters = FilterReferenceList(ac.Deleters, r)
-		ac.Readers = FilterReferenceList(ac.Readers, r)
-
-		ac.Updaters = append(ac.Updaters, r)
+		ac.Denied = append(FilterReferenceList(ac.Denied, r), r)
 	}
 }
 
-func (ac *AC) PermitDelete(refs ...Referencer) {
+// Undeny lifts a previous Deny.
+func (ac *AC) Undeny(refs ...Referencer) {
 	for _, ref := range refs {
-		r := ref.Ref()
-		ac.Updaters = FilterReferenceList(ac.Updaters, r)
-		ac.Deleters = FilterReferenceList(ac.Deleters, r)
-		ac.Readers = FilterReferenceList(ac.Readers, r)
+		ac.Denied = FilterReferenceList(ac.Denied, ref.Ref())
+	}
+}
 
-		ac.Deleters = append(ac.Deleters, r)
+// Denies reports whether any of refs is denied.
+func (ac AC) Denies(refs ...Referencer) bool {
+	for _, ref := range refs {
+		id := ref.Ref()
+		for _, idInSet := range ac.Denied {
+			if idInSet.Col == id.Col && idInSet.ID == id.ID {
+				return true
+			}
+		}
 	}
+	return false
 }
@@ -144,3 +144,103 @@ func TestACL(t *testing.T) {
 func TestMakeReferenceList(t *testing.T) {
 	acmogo.MakeReferenceList("col", []bson.ObjectId{bson.NewObjectId(), bson.NewObjectId()}...)
 }
+
+const (
+	Comment acmogo.Permission = "comment"
+	Admin   acmogo.Permission = "admin"
+	React   acmogo.Permission = "react"
+)
+
+func init() {
+	if err := acmogo.RegisterPermission(Comment, acmogo.Read); err != nil {
+		panic(err)
+	}
+	if err := acmogo.RegisterPermission(Admin, acmogo.Delete, Comment); err != nil {
+		panic(err)
+	}
+	if err := acmogo.RegisterPermission(React, acmogo.Read); err != nil {
+		panic(err)
+	}
+}
+
+func TestRegisterPermission(t *testing.T) {
+	if err := acmogo.RegisterPermission(Admin); err == nil {
+		t.Error("registering a permission twice should fail")
+	}
+	if err := acmogo.RegisterPermission("share", "unknown"); err != acmogo.ErrUnknownPermission {
+		t.Errorf("expected unknown permission error but got %v", err)
+	}
+	if err := acmogo.RegisterPermission("a.b"); err != acmogo.ErrInvalidPermission {
+		t.Errorf("expected invalid permission error but got %v", err)
+	}
+	if !Admin.Implies(acmogo.Read) || !Admin.Implies(Comment) {
+		t.Error("admin should imply read and comment")
+	}
+	if Comment.Implies(acmogo.Update) {
+		t.Error("comment should not imply update")
+	}
+}
+
+func TestAC_Permit(t *testing.T) {
+	user0 := User{Entity: acmogo.New()}
+	user1 := User{Entity: acmogo.New()}
+	post0 := Post{Entity: acmogo.New()}
+
+	if err := post0.Permit(Comment, user0); err != nil {
+		t.Fatal(err)
+	}
+	if !post0.Permitted(Comment, user0) || !post0.ReadPermitted(user0) {
+		t.Error("comment and read should be permitted")
+	}
+	if post0.UpdatePermitted(user0) || post0.Permitted(Admin, user0) {
+		t.Error("update and admin should not be permitted")
+	}
+
+	post0.Permit(Admin, user0)
+	if len(post0.References(Comment)) != 0 {
+		t.Error("permit should replace the previous permission")
+	}
+	for _, perm := range []acmogo.Permission{acmogo.Read, acmogo.Update, acmogo.Delete, Comment, Admin} {
+		if !post0.Permitted(perm, user0) {
+			t.Errorf("%s should be permitted for admin", perm)
+		}
+	}
+
+	post0.PermitRead(user0)
+	if post0.Permitted(Admin, user0) || post0.Permitted(Comment, user0) {
+		t.Error("admin and comment should not be permitted after downgrade")
+	}
+
+	if err := post0.Permit("unknown", user1); err != acmogo.ErrUnknownPermission {
+		t.Errorf("expected unknown permission error but got %v", err)
+	}
+	if post0.Permitted("unknown", user0) {
+		t.Error("unknown permissions should never be permitted")
+	}
+}
+
+func TestAC_Deny(t *testing.T) {
+	user0 := User{Entity: acmogo.New()}
+	team0 := Team{Entity: acmogo.New()}
+	post0 := Post{Entity: acmogo.New()}
+
+	post0.SetCreator(user0.Ref())
+	post0.PermitDelete(team0)
+	post0.Public = true
+
+	post0.Deny(user0)
+	if post0.ReadPermitted(user0) {
+		t.Error("deny should override public and creator")
+	}
+	if post0.DeletePermitted(user0, team0) {
+		t.Error("deny should override a team grant")
+	}
+	if !post0.DeletePermitted(team0) {
+		t.Error("delete should be permitted for the team alone")
+	}
+
+	post0.Undeny(user0)
+	if !post0.DeletePermitted(user0) {
+		t.Error("delete should be permitted after undeny")
+	}
+}
@@ -0,0 +1,200 @@
+package acmogo
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+)
+
+// AuditCol is the collection Auditor records access control changes in.
+var AuditCol = "_acaudit"
+
+// The operations an AuditEntry can record.
+const (
+	OpClearAccessControl = "clear"
+	OpPermit             = "permit"
+	OpPermitBetween      = "permit-between"
+	OpDeny               = "deny"
+	OpUndeny             = "undeny"
+	OpPublic             = "public"
+	OpPrivate            = "private"
+)
+
+// AuditEntry records a single change to the AC of an entity.
+// An entry is stored as Pending before the change is made and completed,
+// with After set, once it was. A Pending entry is a change that failed,
+// whose outcome is unknown, or that was made but not completed in the log.
+type AuditEntry struct {
+	ID         bson.ObjectId `json:"_id" bson:"_id"`
+	Actor      Reference     `json:"actor" bson:"actor"`
+	Target     Reference     `json:"target" bson:"target"`
+	Operation  string        `json:"op" bson:"op"`
+	Permission Permission    `json:"p,omitempty" bson:"p,omitempty"`
+	Principals []Reference   `json:"principals,omitempty" bson:"principals,omitempty"`
+	Time       time.Time     `json:"t" bson:"t"`
+	Before     AC            `json:"before" bson:"before"`
+	After      AC            `json:"after" bson:"after"`
+	Pending    bool          `json:"pending,omitempty" bson:"pending,omitempty"`
+}
+
+// Auditor runs the Persist functions on behalf of an actor
+// and records every change it makes in AuditCol.
+type Auditor struct {
+	p     Persistence
+	actor Reference
+}
+
+func NewAuditor(db *mgo.Database, actor Referencer) Auditor {
+	return mgoPersistence(db).NewAuditor(actor)
+}
+
+func (p Persistence) NewAuditor(actor Referencer) Auditor {
+	return Auditor{p: p, actor: actor.Ref()}
+}
+
+// WithContext returns a copy of a whose changes honor the deadline and
+// cancellation of ctx. If ctx carries an actor, set with ContextWithActor,
+// the changes are recorded on its behalf.
+func (a Auditor) WithContext(ctx context.Context) Auditor {
+	a.p = a.p.WithContext(ctx)
+	if actor, ok := ActorFromContext(ctx); ok {
+		a.actor = actor
+	}
+	return a
+}
+
+func (a Auditor) PersistClearAccessControl(entity Referencer, entities ...Referencer) error {
+	return a.record(entity, OpClearAccessControl, "", entities, func() error {
+		return a.p.PersistClearAccessControl(entity, entities...)
+	})
+}
+
+func (a Auditor) PersistPermitRead(entity Referencer, entities ...Referencer) error {
+	return a.PersistPermit(entity, Read, entities...)
+}
+
+func (a Auditor) PersistPermitUpdate(entity Referencer, entities ...Referencer) error {
+	return a.PersistPermit(entity, Update, entities...)
+}
+
+func (a Auditor) PersistPermitDelete(entity Referencer, entities ...Referencer) error {
+	return a.PersistPermit(entity, Delete, entities...)
+}
+
+func (a Auditor) PersistPermit(entity Referencer, perm Permission, entities ...Referencer) error {
+	return a.record(entity, OpPermit, perm, entities, func() error {
+		return a.p.PersistPermit(entity, perm, entities...)
+	})
+}
+
+func (a Auditor) PersistPermitBetween(entity Referencer, perm Permission, notBefore, expiresAt time.Time, entities ...Referencer) error {
+	return a.record(entity, OpPermitBetween, perm, entities, func() error {
+		return a.p.PersistPermitBetween(entity, perm, notBefore, expiresAt, entities...)
+	})
+}
+
+func (a Auditor) PersistDeny(entity Referencer, entities ...Referencer) error {
+	return a.record(entity, OpDeny, "", entities, func() error {
+		return a.p.PersistDeny(entity, entities...)
+	})
+}
+
+func (a Auditor) PersistUndeny(entity Referencer, entities ...Referencer) error {
+	return a.record(entity, OpUndeny, "", entities, func() error {
+		return a.p.PersistUndeny(entity, entities...)
+	})
+}
+
+func (a Auditor) PersistPublic(entity Referencer) error {
+	return a.record(entity, OpPublic, "", nil, func() error {
+		return a.p.PersistPublic(entity)
+	})
+}
+
+func (a Auditor) PersistPrivate(entity Referencer) error {
+	return a.record(entity, OpPrivate, "", nil, func() error {
+		return a.p.PersistPrivate(entity)
+	})
+}
+
+// record stores a pending AuditEntry with the AC of entity as it is,
+// applies change and completes the entry with the AC as it is after.
+// No change is made if the entry cannot be stored.
+func (a Auditor) record(entity Referencer, op string, perm Permission, principals []Referencer, change func() error) error {
+	ref := entity.Ref()
+	before, err := a.p.Uncached().loadEntity(ref)
+	if err != nil {
+		return err
+	}
+	entry := AuditEntry{
+		ID:         bson.NewObjectId(),
+		Actor:      a.actor,
+		Target:     ref,
+		Operation:  op,
+		Permission: perm,
+		Principals: refList(principals),
+		Time:       Now(),
+		Before:     before.AC,
+		Pending:    true,
+	}
+	if err := a.p.Store.Insert(AuditCol, entry); err != nil {
+		return err
+	}
+	if err := change(); err != nil {
+		return err
+	}
+	after, err := a.p.Uncached().loadEntity(ref)
+	if err != nil {
+		return err
+	}
+	return a.p.Store.UpdateId(AuditCol, entry.ID, Map{
+		"$set":   Map{"after": after.AC},
+		"$unset": Map{"pending": 1},
+	})
+}
+
+// EntityHistory returns the recorded changes to the AC of entity, oldest first.
+func EntityHistory(db *mgo.Database, entity Referencer) ([]AuditEntry, error) {
+	return mgoPersistence(db).EntityHistory(entity)
+}
+
+func (p Persistence) EntityHistory(entity Referencer) ([]AuditEntry, error) {
+	return p.history(Map{"target": entity.Ref()})
+}
+
+// PrincipalHistory returns the recorded changes that affected
+// the access of principal, oldest first.
+func PrincipalHistory(db *mgo.Database, principal Referencer) ([]AuditEntry, error) {
+	return mgoPersistence(db).PrincipalHistory(principal)
+}
+
+func (p Persistence) PrincipalHistory(principal Referencer) ([]AuditEntry, error) {
+	return p.history(Map{"principals": principal.Ref()})
+}
+
+// ActorHistory returns the recorded changes made by actor, oldest first.
+func ActorHistory(db *mgo.Database, actor Referencer) ([]AuditEntry, error) {
+	return mgoPersistence(db).ActorHistory(actor)
+}
+
+func (p Persistence) ActorHistory(actor Referencer) ([]AuditEntry, error) {
+	return p.history(Map{"actor": actor.Ref()})
+}
+
+// history returns the entries in AuditCol matching filter, oldest first.
+func (p Persistence) history(filter Map) ([]AuditEntry, error) {
+	var entries []AuditEntry
+	if err := p.Store.Find(AuditCol, filter, nil, &entries); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if !entries[i].Time.Equal(entries[j].Time) {
+			return entries[i].Time.Before(entries[j].Time)
+		}
+		return entries[i].ID < entries[j].ID
+	})
+	return entries, nil
+}
@@ -0,0 +1,111 @@
+package acmogo_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/crhntr/acmogo"
+	"github.com/crhntr/acmogo/memstore"
+	"github.com/globalsign/mgo/bson"
+)
+
+func TestAuditor(t *testing.T) {
+	requireDB(t)
+
+	admin := User{Entity: acmogo.New()}
+	user0 := User{Entity: acmogo.New()}
+	post0 := Post{Entity: acmogo.New()}
+	post1 := Post{Entity: acmogo.New()}
+
+	acmogo.InsertList(db, post0)
+
+	auditor := acmogo.NewAuditor(db, admin)
+	if err := auditor.PersistPermitRead(post0, user0); err != nil {
+		t.Fatal(err)
+	}
+	if err := auditor.PersistPermitUpdate(post0, user0); err != nil {
+		t.Fatal(err)
+	}
+	if err := auditor.PersistClearAccessControl(post0, user0); err != nil {
+		t.Fatal(err)
+	}
+	if err := auditor.PersistPermitRead(post1, user0); err == nil {
+		t.Error("expected an error changing a missing entity")
+	}
+
+	entries, err := acmogo.EntityHistory(db, post0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 audit entries but got %d", len(entries))
+	}
+
+	permitRead, permitUpdate, clear := entries[0], entries[1], entries[2]
+	if permitRead.Operation != acmogo.OpPermit || permitRead.Permission != acmogo.Read || permitRead.Actor != admin.Ref() {
+		t.Errorf("unexpected first entry %+v", permitRead)
+	}
+	if permitRead.Before.ReadPermitted(user0) || !permitRead.After.ReadPermitted(user0) {
+		t.Error("expected the first entry to record read being granted")
+	}
+	if permitUpdate.Before.UpdatePermitted(user0) || !permitUpdate.After.UpdatePermitted(user0) {
+		t.Error("expected the second entry to record update being granted")
+	}
+	if clear.Operation != acmogo.OpClearAccessControl || clear.After.ReadPermitted(user0) {
+		t.Errorf("unexpected last entry %+v", clear)
+	}
+
+	entries, err = acmogo.PrincipalHistory(db, user0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Errorf("expected 3 audit entries for the principal but got %d", len(entries))
+	}
+}
+
+// failingUpdates is a Store whose updates outside AuditCol fail.
+type failingUpdates struct {
+	acmogo.Store
+}
+
+var errUpdate = errors.New("update failed")
+
+func (s failingUpdates) UpdateId(col string, id bson.ObjectId, update acmogo.Map) error {
+	if col != acmogo.AuditCol {
+		return errUpdate
+	}
+	return s.Store.UpdateId(col, id, update)
+}
+
+func TestPersistence_NewAuditor(t *testing.T) {
+	store := memstore.New()
+	admin := User{Entity: acmogo.New()}
+	user0 := User{Entity: acmogo.New()}
+	post0 := Post{Entity: acmogo.New()}
+
+	p := store.Persistence()
+	p.InsertList(post0)
+
+	if err := p.NewAuditor(admin).PersistPermitRead(post0, user0); err != nil {
+		t.Fatal(err)
+	}
+	failing := acmogo.Persistence{Store: failingUpdates{Store: store}}
+	if err := failing.NewAuditor(admin).PersistDeny(post0, user0); err != errUpdate {
+		t.Fatalf("expected the update error but got %v", err)
+	}
+
+	entries, err := p.EntityHistory(post0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 audit entries but got %d", len(entries))
+	}
+	if permit := entries[0]; permit.Pending || !permit.After.ReadPermitted(user0) {
+		t.Errorf("expected a completed entry but got %+v", permit)
+	}
+	if deny := entries[1]; !deny.Pending || deny.Operation != acmogo.OpDeny || !deny.Before.ReadPermitted(user0) {
+		t.Errorf("expected a pending deny entry but got %+v", deny)
+	}
+}
@@ -0,0 +1,136 @@
+package acmogo
+
+import (
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+)
+
+// Outcome is the result of a batch permission check for one entity.
+type Outcome int
+
+const (
+	OutcomeForbidden Outcome = iota
+	OutcomePermitted
+	OutcomeNotFound
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case OutcomePermitted:
+		return "permitted"
+	case OutcomeNotFound:
+		return "not found"
+	default:
+		return "forbidden"
+	}
+}
+
+func BatchReadPermitted(db *mgo.Database, entities []Referencer, refs ...Referencer) (map[Reference]Outcome, error) {
+	return mgoPersistence(db).BatchPermitted(entities, Read, refs...)
+}
+
+func BatchUpdatePermitted(db *mgo.Database, entities []Referencer, refs ...Referencer) (map[Reference]Outcome, error) {
+	return mgoPersistence(db).BatchPermitted(entities, Update, refs...)
+}
+
+func BatchDeletePermitted(db *mgo.Database, entities []Referencer, refs ...Referencer) (map[Reference]Outcome, error) {
+	return mgoPersistence(db).BatchPermitted(entities, Delete, refs...)
+}
+
+func (p Persistence) BatchReadPermitted(entities []Referencer, refs ...Referencer) (map[Reference]Outcome, error) {
+	return p.BatchPermitted(entities, Read, refs...)
+}
+
+func (p Persistence) BatchUpdatePermitted(entities []Referencer, refs ...Referencer) (map[Reference]Outcome, error) {
+	return p.BatchPermitted(entities, Update, refs...)
+}
+
+func (p Persistence) BatchDeletePermitted(entities []Referencer, refs ...Referencer) (map[Reference]Outcome, error) {
+	return p.BatchPermitted(entities, Delete, refs...)
+}
+
+// BatchPermitted is like Permitted for many entities. It loads the
+// stored ACs with one query per collection and returns the outcome
+// for every entity. Parents are loaded once each as they are needed and
+// entities with broken inheritance chains are forbidden, as with Permitted.
+func BatchPermitted(db *mgo.Database, entities []Referencer, perm Permission, refs ...Referencer) (map[Reference]Outcome, error) {
+	return mgoPersistence(db).BatchPermitted(entities, perm, refs...)
+}
+
+func (p Persistence) BatchPermitted(entities []Referencer, perm Permission, refs ...Referencer) (map[Reference]Outcome, error) {
+	loaded, err := p.loadEntities(refList(entities))
+	if err != nil {
+		return nil, err
+	}
+	load := p.memoLoader(loaded)
+
+	outcomes := make(map[Reference]Outcome, len(entities))
+	for _, entity := range entities {
+		ref := entity.Ref()
+		ent, ok := loaded[ref]
+		if !ok || ent.Trashed() {
+			outcomes[ref] = OutcomeNotFound
+			continue
+		}
+		permitted, err := ent.InheritedPermitted(load, perm, refs...)
+		if err != nil && err != ErrInheritanceCycle && err != ErrInheritanceDepth {
+			return outcomes, err
+		}
+		if permitted {
+			outcomes[ref] = OutcomePermitted
+		} else {
+			outcomes[ref] = OutcomeForbidden
+		}
+	}
+	return outcomes, nil
+}
+
+// memoLoader returns an EntityLoader that loads every entity
+// at most once, starting with those already in loaded.
+func (p Persistence) memoLoader(loaded map[Reference]Entity) EntityLoader {
+	return func(ref Reference) (Entity, error) {
+		if ent, ok := loaded[ref]; ok {
+			return ent, nil
+		}
+		ent, err := p.loadEntity(ref)
+		if err == nil {
+			loaded[ref] = ent
+		}
+		return ent, err
+	}
+}
+
+// loadEntities loads the SelectEntityDoc fields of the documents refs
+// point to with one $in query per collection for those not in the Cache.
+// Documents that do not exist are missing from the result.
+func (p Persistence) loadEntities(refs []Reference) (map[Reference]Entity, error) {
+	cache := p.Cache != nil && !p.uncached
+	loaded := make(map[Reference]Entity, len(refs))
+	ids := make(map[string][]bson.ObjectId)
+	for _, ref := range DedupReferenceList(refs) {
+		if cache {
+			if ent, ok := p.Cache.Get(ref); ok {
+				loaded[ref] = ent
+				continue
+			}
+		}
+		ids[ref.Col] = append(ids[ref.Col], ref.ID)
+	}
+	var gen uint64
+	if cache {
+		gen = p.Cache.Generation()
+	}
+	for col, colIDs := range ids {
+		var ents []Entity
+		if err := p.Store.Find(col, Map{"_id": Map{"$in": colIDs}}, toMap(SelectEntityDoc), &ents); err != nil {
+			return nil, err
+		}
+		for _, ent := range ents {
+			loaded[Reference{col, ent.ID}] = ent
+			if cache {
+				p.Cache.AddSince(Reference{col, ent.ID}, ent, gen)
+			}
+		}
+	}
+	return loaded, nil
+}
@@ -0,0 +1,47 @@
+package acmogo_test
+
+import (
+	"testing"
+
+	"github.com/crhntr/acmogo"
+	"github.com/crhntr/acmogo/memstore"
+)
+
+func TestBatchPermitted(t *testing.T) {
+	p := memstore.New().Persistence()
+	user0 := User{Entity: acmogo.New()}
+	team0 := Team{Entity: acmogo.New()}
+	post0 := Post{Entity: acmogo.New()}
+	post1 := Post{Entity: acmogo.New()}
+	post2 := Post{Entity: acmogo.New()}
+	post3 := Post{Entity: acmogo.New()}
+
+	team0.PermitUpdate(user0)
+	post0.PermitRead(user0)
+	post1.SetParent(team0.Ref())
+	p.InsertList(team0, post0, post1, post2)
+
+	outcomes, err := p.BatchReadPermitted([]acmogo.Referencer{post0, post1, post2, post3, team0}, user0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ref, expected := range map[acmogo.Reference]acmogo.Outcome{
+		post0.Ref(): acmogo.OutcomePermitted,
+		post1.Ref(): acmogo.OutcomePermitted,
+		post2.Ref(): acmogo.OutcomeForbidden,
+		post3.Ref(): acmogo.OutcomeNotFound,
+		team0.Ref(): acmogo.OutcomePermitted,
+	} {
+		if outcomes[ref] != expected {
+			t.Errorf("expected %s to be %s but got %s", ref.Col, expected, outcomes[ref])
+		}
+	}
+
+	outcomes, err = p.BatchUpdatePermitted([]acmogo.Referencer{post0, post1}, user0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outcomes[post0.Ref()] != acmogo.OutcomeForbidden || outcomes[post1.Ref()] != acmogo.OutcomePermitted {
+		t.Errorf("unexpected update outcomes %v", outcomes)
+	}
+}
@@ -0,0 +1,169 @@
+package acmogo
+
+import "github.com/globalsign/mgo"
+
+// BulkStore is a Store that can insert many documents in one round trip.
+// InsertMany returns the errors of the documents that failed by their
+// index in docs. When ordered is true it stops at the first failure.
+// err is set if the outcome of the documents not in failed is unknown,
+// for example after a network or write concern error.
+type BulkStore interface {
+	InsertMany(col string, ordered bool, docs []interface{}) (failed map[int]error, err error)
+}
+
+// InsertFailure is why an entity was not inserted.
+// Duplicate is true if its id, or another unique key, was already stored.
+// Error is the message of Err, for the JSON form.
+type InsertFailure struct {
+	Ref       Reference `json:"ref"`
+	Duplicate bool      `json:"duplicate"`
+	Error     string    `json:"error"`
+	Err       error     `json:"-"`
+}
+
+// BulkInsertResult lists the outcome of every entity passed to BulkInsert.
+// Skipped entities were not attempted after an error in ordered mode.
+// Unknown entities may or may not have been stored; their Err is the
+// error that left the outcome unknown.
+type BulkInsertResult struct {
+	Inserted []Reference     `json:"inserted"`
+	Failed   []InsertFailure `json:"failed,omitempty"`
+	Skipped  []Reference     `json:"skipped,omitempty"`
+	Unknown  []InsertFailure `json:"unknown,omitempty"`
+}
+
+// Err returns the error of the first failure, if any,
+// and otherwise that of the first unknown outcome.
+func (r BulkInsertResult) Err() error {
+	switch {
+	case len(r.Failed) > 0:
+		return r.Failed[0].Err
+	case len(r.Unknown) > 0:
+		return r.Unknown[0].Err
+	}
+	return nil
+}
+
+// DuplicateKeyError is implemented by the errors of Stores other than
+// MgoStore to tell IsDup whether a unique key was already stored.
+type DuplicateKeyError interface {
+	error
+	DuplicateKey() bool
+}
+
+// IsDup reports whether err is the error of an insert or update
+// that failed because its _id, or another unique key, was already stored.
+func IsDup(err error) bool {
+	if err, ok := err.(DuplicateKeyError); ok {
+		return err.DuplicateKey()
+	}
+	return mgo.IsDup(err)
+}
+
+// BulkInsert stores entities with one unordered bulk insert per collection
+// and reports which of them were inserted. A failure does not stop the
+// other entities being inserted. The error is that of the first failure.
+// Like InsertList it does not apply policies; InsertAs does.
+func BulkInsert(db *mgo.Database, entities ...Referencer) (BulkInsertResult, error) {
+	return mgoPersistence(db).BulkInsert(entities...)
+}
+
+// BulkInsertOrdered is like BulkInsert but inserts entities in order,
+// batching consecutive entities of the same collection,
+// and stops at the first failure.
+func BulkInsertOrdered(db *mgo.Database, entities ...Referencer) (BulkInsertResult, error) {
+	return mgoPersistence(db).BulkInsertOrdered(entities...)
+}
+
+func (p Persistence) BulkInsert(entities ...Referencer) (BulkInsertResult, error) {
+	var (
+		result BulkInsertResult
+		cols   []string
+		groups = make(map[string][]Referencer)
+	)
+	for _, entity := range entities {
+		col := entity.Ref().Col
+		if _, ok := groups[col]; !ok {
+			cols = append(cols, col)
+		}
+		groups[col] = append(groups[col], entity)
+	}
+	for _, col := range cols {
+		p.insertMany(col, false, groups[col], &result)
+	}
+	return result, result.Err()
+}
+
+func (p Persistence) BulkInsertOrdered(entities ...Referencer) (BulkInsertResult, error) {
+	var result BulkInsertResult
+	for start := 0; start < len(entities); {
+		col := entities[start].Ref().Col
+		end := start + 1
+		for end < len(entities) && entities[end].Ref().Col == col {
+			end++
+		}
+		if !p.insertMany(col, true, entities[start:end], &result) {
+			for _, entity := range entities[end:] {
+				result.Skipped = append(result.Skipped, entity.Ref())
+			}
+			break
+		}
+		start = end
+	}
+	return result, result.Err()
+}
+
+// insertMany inserts entities into col, adding their outcomes to result.
+// It reports whether all of them are known to be inserted.
+func (p Persistence) insertMany(col string, ordered bool, entities []Referencer, result *BulkInsertResult) bool {
+	docs := make([]interface{}, len(entities))
+	for i, entity := range entities {
+		docs[i] = entity
+		if p.Cache != nil {
+			p.Cache.Invalidate(entity.Ref())
+		}
+	}
+	failed, err := insertMany(p.Store, col, ordered, docs)
+
+	first := len(entities)
+	for i := range entities {
+		if _, ok := failed[i]; ok && i < first {
+			first = i
+		}
+	}
+	for i, entity := range entities {
+		ref := entity.Ref()
+		switch failure, ok := failed[i]; {
+		case ok:
+			result.Failed = append(result.Failed, InsertFailure{Ref: ref, Duplicate: IsDup(failure), Error: failure.Error(), Err: failure})
+		case ordered && i > first:
+			result.Skipped = append(result.Skipped, ref)
+		case err != nil:
+			result.Unknown = append(result.Unknown, InsertFailure{Ref: ref, Error: err.Error(), Err: err})
+		default:
+			result.Inserted = append(result.Inserted, ref)
+		}
+	}
+	return len(failed) == 0 && err == nil
+}
+
+// insertMany uses the InsertMany of a BulkStore and otherwise inserts docs one by one.
+func insertMany(s Store, col string, ordered bool, docs []interface{}) (map[int]error, error) {
+	if bs, ok := s.(BulkStore); ok {
+		return bs.InsertMany(col, ordered, docs)
+	}
+	return insertEach(s, col, ordered, docs), nil
+}
+
+func insertEach(s Store, col string, ordered bool, docs []interface{}) map[int]error {
+	failed := make(map[int]error)
+	for i, doc := range docs {
+		if err := s.Insert(col, doc); err != nil {
+			failed[i] = err
+			if ordered {
+				break
+			}
+		}
+	}
+	return failed
+}
@@ -0,0 +1,139 @@
+package acmogo_test
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/crhntr/acmogo"
+	"github.com/crhntr/acmogo/memstore"
+	"github.com/globalsign/mgo"
+)
+
+func TestBulkInsert(t *testing.T) {
+	p := memstore.New().Persistence()
+	post0 := Post{Entity: acmogo.New()}
+	post1 := Post{Entity: acmogo.New()}
+	post2 := Post{Entity: acmogo.New()}
+	team0 := Team{Entity: acmogo.New()}
+	p.InsertList(post1)
+
+	result, err := p.BulkInsert(post0, team0, post1, post2)
+	if err == nil {
+		t.Error("expected the duplicate to be reported")
+	}
+	if len(result.Inserted) != 3 || len(result.Failed) != 1 || len(result.Skipped) != 0 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if f := result.Failed[0]; f.Ref != post1.Ref() || !f.Duplicate {
+		t.Errorf("expected post1 to fail as a duplicate but got %+v", f)
+	}
+}
+
+func TestBulkInsertOrdered(t *testing.T) {
+	p := memstore.New().Persistence()
+	post0 := Post{Entity: acmogo.New()}
+	post1 := Post{Entity: acmogo.New()}
+	post2 := Post{Entity: acmogo.New()}
+	team0 := Team{Entity: acmogo.New()}
+	p.InsertList(post1)
+
+	result, err := p.BulkInsertOrdered(post0, post1, post2, team0)
+	if err == nil {
+		t.Error("expected the duplicate to be reported")
+	}
+	if len(result.Inserted) != 1 || result.Inserted[0] != post0.Ref() {
+		t.Errorf("expected only post0 to be inserted but got %v", result.Inserted)
+	}
+	if len(result.Failed) != 1 || result.Failed[0].Ref != post1.Ref() {
+		t.Errorf("expected post1 to fail but got %+v", result.Failed)
+	}
+	if len(result.Skipped) != 2 || result.Skipped[0] != post2.Ref() || result.Skipped[1] != team0.Ref() {
+		t.Errorf("expected the rest to be skipped but got %v", result.Skipped)
+	}
+	if err := p.RefreshEntity(&team0); err != acmogo.ErrNotFound {
+		t.Errorf("expected skipped entities not to be stored but got %v", err)
+	}
+}
+
+// unacknowledged is a BulkStore that fails the second document of every
+// insert and loses the acknowledgement of the others.
+type unacknowledged struct {
+	acmogo.Store
+}
+
+var errUnacknowledged = errors.New("write concern not satisfied")
+
+func (s unacknowledged) InsertMany(col string, ordered bool, docs []interface{}) (map[int]error, error) {
+	return map[int]error{1: duplicateKey{}}, errUnacknowledged
+}
+
+type duplicateKey struct{}
+
+func (duplicateKey) Error() string      { return "duplicate key" }
+func (duplicateKey) DuplicateKey() bool { return true }
+
+func TestBulkInsert_Unknown(t *testing.T) {
+	p := acmogo.Persistence{Store: unacknowledged{Store: memstore.New()}}
+	post0 := Post{Entity: acmogo.New()}
+	post1 := Post{Entity: acmogo.New()}
+	post2 := Post{Entity: acmogo.New()}
+	team0 := Team{Entity: acmogo.New()}
+
+	result, err := p.BulkInsert(post0, post1, post2)
+	if _, ok := err.(duplicateKey); !ok {
+		t.Errorf("expected the failure to be reported first but got %v", err)
+	}
+	if len(result.Inserted) != 0 || len(result.Failed) != 1 || len(result.Unknown) != 2 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if f := result.Failed[0]; f.Ref != post1.Ref() || !f.Duplicate {
+		t.Errorf("expected post1 to fail as a duplicate but got %+v", f)
+	}
+	if u := result.Unknown[0]; u.Ref != post0.Ref() || u.Err != errUnacknowledged {
+		t.Errorf("expected the outcome of post0 to be unknown but got %+v", u)
+	}
+
+	buf, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(buf), `"error":"duplicate key"`) || !strings.Contains(string(buf), `"error":"write concern not satisfied"`) {
+		t.Errorf("expected the JSON result to name the errors but got %s", buf)
+	}
+
+	result, _ = p.BulkInsertOrdered(post0, post1, post2, team0)
+	if len(result.Unknown) != 1 || len(result.Failed) != 1 || len(result.Skipped) != 2 {
+		t.Errorf("unexpected ordered result %+v", result)
+	}
+}
+
+// bulkError is an error of a bulk insert as mgo reports it.
+type bulkError []mgo.BulkErrorCase
+
+func (err bulkError) Error() string              { return "bulk insert failed" }
+func (err bulkError) Cases() []mgo.BulkErrorCase { return err }
+
+func TestMgoStore_BulkFailures(t *testing.T) {
+	dup := &mgo.QueryError{Code: 11000, Message: "E11000 duplicate key error"}
+	concern := &mgo.LastError{Code: 64, Err: "waiting for replication timed out"}
+
+	failed, err := acmogo.BulkFailures(bulkError{{Index: 1, Err: dup}, {Index: 0, Err: concern}, {Index: 2, Err: concern}})
+	if len(failed) != 1 || failed[1] != dup || !acmogo.IsDup(failed[1]) {
+		t.Errorf("expected only the rejected document to fail but got %v", failed)
+	}
+	if err != concern {
+		t.Errorf("expected the write concern error to leave the others unknown but got %v", err)
+	}
+
+	network := errors.New("connection reset")
+	failed, err = acmogo.BulkFailures(bulkError{{Index: 0, Err: network}, {Index: 1, Err: network}})
+	if len(failed) != 0 || err != network {
+		t.Errorf("expected a batch failing as a whole to be unknown but got %v, %v", failed, err)
+	}
+
+	if failed, err := acmogo.BulkFailures(nil); len(failed) != 0 || err != nil {
+		t.Errorf("expected no failures but got %v, %v", failed, err)
+	}
+}
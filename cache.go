@@ -0,0 +1,183 @@
+package acmogo
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// ACCache is a bounded LRU cache of the SelectEntityDoc fields loaded
+// by permission checks, keyed by Reference. Entries expire after a TTL.
+// It is safe for concurrent use and can be shared by many Persistences.
+//
+// Only the methods of a Persistence holding the cache invalidate it.
+// Changes made through the package level functions taking an
+// *mgo.Database, through another Persistence, or by other processes
+// are seen once the entries they made stale expire, so give a cache
+// shared with such writers a TTL.
+type ACCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List
+	entries map[Reference]*list.Element
+	stats   CacheStats
+
+	// gen counts invalidations. invalidated and colInvalidated hold the
+	// generation a reference or collection was last invalidated in,
+	// except for those invalidated before floor.
+	gen            uint64
+	floor          uint64
+	invalidated    map[Reference]uint64
+	colInvalidated map[string]uint64
+}
+
+// CacheStats counts the lookups an ACCache answered.
+type CacheStats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+}
+
+type cacheEntry struct {
+	ref     Reference
+	ent     Entity
+	expires time.Time
+}
+
+// NewACCache returns a cache holding at most size entries, each for at most ttl.
+// A ttl of zero keeps entries until they are evicted or invalidated.
+func NewACCache(size int, ttl time.Duration) *ACCache {
+	return &ACCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[Reference]*list.Element),
+
+		invalidated:    make(map[Reference]uint64),
+		colInvalidated: make(map[string]uint64),
+	}
+}
+
+// Get returns the cached entity ref points to.
+func (c *ACCache) Get(ref Reference) (Entity, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[ref]
+	if ok && c.ttl > 0 && !Now().Before(elem.Value.(*cacheEntry).expires) {
+		c.remove(elem)
+		ok = false
+	}
+	if !ok {
+		c.stats.Misses++
+		return Entity{}, false
+	}
+	c.stats.Hits++
+	c.order.MoveToFront(elem)
+	ent := elem.Value.(*cacheEntry).ent
+	ent.AC = ent.AC.clone()
+	return ent, true
+}
+
+// Add caches ent as the entity ref points to,
+// evicting the least recently used entry if the cache is full.
+func (c *ACCache) Add(ref Reference, ent Entity) {
+	if c.size <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.add(ref, ent)
+}
+
+// Generation returns the current generation of the cache.
+// Call it before reading an entity to be passed to AddSince.
+func (c *ACCache) Generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+// AddSince is like Add but does nothing if ref was invalidated after gen,
+// as ent, read since then, may already be stale.
+func (c *ACCache) AddSince(ref Reference, ent Entity, gen uint64) {
+	if c.size <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen < c.floor || c.invalidated[ref] > gen || c.colInvalidated[ref.Col] > gen {
+		return
+	}
+	c.add(ref, ent)
+}
+
+func (c *ACCache) add(ref Reference, ent Entity) {
+	ent.AC = ent.AC.clone()
+	entry := &cacheEntry{ref: ref, ent: ent, expires: Now().Add(c.ttl)}
+	if elem, ok := c.entries[ref]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[ref] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+// Invalidate removes the entries for refs.
+func (c *ACCache) Invalidate(refs ...Reference) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextGen()
+	for _, ref := range refs {
+		c.invalidated[ref] = c.gen
+		if elem, ok := c.entries[ref]; ok {
+			c.remove(elem)
+		}
+	}
+}
+
+// InvalidateCol removes the entries for every document in col.
+func (c *ACCache) InvalidateCol(col string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextGen()
+	c.colInvalidated[col] = c.gen
+	for ref, elem := range c.entries {
+		if ref.Col == col {
+			c.remove(elem)
+		}
+	}
+}
+
+// nextGen starts a new generation. Once more references have been
+// invalidated than the cache holds it forgets them, raising the floor
+// so adds of entities read before are dropped.
+func (c *ACCache) nextGen() {
+	if len(c.invalidated)+len(c.colInvalidated) > c.size {
+		c.floor = c.gen
+		c.invalidated = make(map[Reference]uint64)
+		c.colInvalidated = make(map[string]uint64)
+	}
+	c.gen++
+}
+
+// Len returns the number of cached entries, including expired ones not yet removed.
+func (c *ACCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// Stats returns the number of hits and misses since the cache was created.
+func (c *ACCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+func (c *ACCache) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry).ref)
+}
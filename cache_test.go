@@ -0,0 +1,147 @@
+package acmogo_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/crhntr/acmogo"
+	"github.com/crhntr/acmogo/memstore"
+	"github.com/globalsign/mgo/bson"
+)
+
+func TestACCache(t *testing.T) {
+	start := time.Now()
+	now := acmogo.Now
+	defer func() { acmogo.Now = now }()
+	acmogo.Now = func() time.Time { return start }
+
+	post0 := Post{Entity: acmogo.New()}
+	post1 := Post{Entity: acmogo.New()}
+	post2 := Post{Entity: acmogo.New()}
+
+	cache := acmogo.NewACCache(2, time.Minute)
+	cache.Add(post0.Ref(), post0.Entity)
+	cache.Add(post1.Ref(), post1.Entity)
+	cache.Get(post0.Ref())
+	cache.Add(post2.Ref(), post2.Entity)
+
+	if _, ok := cache.Get(post1.Ref()); ok {
+		t.Error("expected the least recently used entry to be evicted")
+	}
+	if _, ok := cache.Get(post0.Ref()); !ok {
+		t.Error("expected a recently used entry to be kept")
+	}
+
+	acmogo.Now = func() time.Time { return start.Add(time.Minute) }
+	if _, ok := cache.Get(post2.Ref()); ok {
+		t.Error("expected the entry to expire")
+	}
+	if stats := cache.Stats(); stats.Hits != 2 || stats.Misses != 2 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestPersistence_Cache(t *testing.T) {
+	store := memstore.New()
+	cache := acmogo.NewACCache(16, time.Minute)
+	p := acmogo.Persistence{Store: store, Cache: cache}
+
+	user0 := User{Entity: acmogo.New()}
+	post0 := Post{Entity: acmogo.New()}
+	p.InsertList(post0)
+
+	if p.ReadPermitted(post0, user0) || p.ReadPermitted(post0, user0) {
+		t.Fatal("read should not be permitted")
+	}
+	if stats := cache.Stats(); stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("expected the second check to hit the cache but got %+v", stats)
+	}
+
+	if err := p.PersistPermitRead(post0, user0); err != nil {
+		t.Fatal(err)
+	}
+	if !p.ReadPermitted(post0, user0) {
+		t.Error("expected the change to invalidate the cache")
+	}
+
+	// a change made behind the back of the Persistence
+	store.UpdateId(PostCol, post0.ID, acmogo.Map{"$set": acmogo.Map{acmogo.ReadersPath: []acmogo.Reference{}}})
+	if !p.ReadPermitted(post0, user0) {
+		t.Error("expected the cached AC to be used")
+	}
+	if p.Uncached().ReadPermitted(post0, user0) {
+		t.Error("expected an uncached check to read the stored AC")
+	}
+}
+
+// staleReads is a Store running invalidate while an entity is being read,
+// as a change made concurrently through the same Cache would.
+type staleReads struct {
+	acmogo.Store
+	invalidate func()
+}
+
+func (s *staleReads) FindId(col string, id bson.ObjectId, projection acmogo.Map, result interface{}) error {
+	err := s.Store.FindId(col, id, projection, result)
+	if s.invalidate != nil {
+		s.invalidate()
+		s.invalidate = nil
+	}
+	return err
+}
+
+func TestPersistence_CacheStaleRead(t *testing.T) {
+	store := &staleReads{Store: memstore.New()}
+	cache := acmogo.NewACCache(16, 0)
+	p := acmogo.Persistence{Store: store, Cache: cache}
+
+	user0 := User{Entity: acmogo.New()}
+	post0 := Post{Entity: acmogo.New()}
+	p.InsertList(post0)
+
+	store.invalidate = func() {
+		if err := p.PersistPermitRead(post0, user0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p.ReadPermitted(post0, user0) {
+		t.Fatal("expected the check to read the AC from before the change")
+	}
+	if !p.ReadPermitted(post0, user0) {
+		t.Error("expected the stale AC not to be cached")
+	}
+}
+
+func TestACCache_AddSince(t *testing.T) {
+	post0 := Post{Entity: acmogo.New()}
+	post1 := Post{Entity: acmogo.New()}
+
+	cache := acmogo.NewACCache(1, 0)
+	gen := cache.Generation()
+	cache.Invalidate(post0.Ref())
+	cache.AddSince(post0.Ref(), post0.Entity, gen)
+	if _, ok := cache.Get(post0.Ref()); ok {
+		t.Error("expected an entity read before it was invalidated to be dropped")
+	}
+	cache.AddSince(post0.Ref(), post0.Entity, cache.Generation())
+	if _, ok := cache.Get(post0.Ref()); !ok {
+		t.Error("expected an entity read after it was invalidated to be cached")
+	}
+
+	gen = cache.Generation()
+	cache.InvalidateCol(PostCol)
+	cache.AddSince(post1.Ref(), post1.Entity, gen)
+	if _, ok := cache.Get(post1.Ref()); ok {
+		t.Error("expected an entity read before its collection was invalidated to be dropped")
+	}
+
+	// more invalidations than the cache holds are forgotten
+	gen = cache.Generation()
+	cache.Invalidate(post0.Ref())
+	cache.Invalidate(post1.Ref())
+	cache.Invalidate(acmogo.Reference{Col: PostCol, ID: bson.NewObjectId()})
+	cache.AddSince(post0.Ref(), post0.Entity, gen)
+	if _, ok := cache.Get(post0.Ref()); ok {
+		t.Error("expected an entity read before forgotten invalidations to be dropped")
+	}
+}
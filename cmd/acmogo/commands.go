@@ -0,0 +1,422 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/crhntr/acmogo"
+	"github.com/globalsign/mgo/bson"
+)
+
+var (
+	errNotPermitted = errors.New("not permitted")
+	errNoActor      = errors.New("changes need an -actor to be recorded as")
+)
+
+// entity is any stored document, read as an acmogo.Entity.
+type entity struct {
+	acmogo.Entity `bson:",inline"`
+	col           string
+}
+
+func (ent entity) Ref() acmogo.Reference {
+	return acmogo.Reference{Col: ent.col, ID: ent.ID}
+}
+
+// holder is a principal holding a permission, as listed by who-can.
+// Group is set if the principal holds it as a member of the group.
+type holder struct {
+	Permission acmogo.Permission `json:"permission"`
+	Principal  *acmogo.Reference `json:"principal,omitempty"`
+	Via        string            `json:"via"`
+	Group      *acmogo.Reference `json:"group,omitempty"`
+	ExpiresAt  *time.Time        `json:"expiresAt,omitempty"`
+}
+
+// decision is a Decision as written by check. DirectOnly is set
+// if the groups of the principals were not considered.
+type decision struct {
+	acmogo.Decision
+	DirectOnly bool `json:"directOnly,omitempty"`
+}
+
+func (cmd command) run(args []string) error {
+	if len(args) == 0 {
+		return errors.New("missing command")
+	}
+	name, args := args[0], args[1:]
+	switch name {
+	case "show":
+		return cmd.show(args)
+	case "grant":
+		return cmd.grant(args)
+	case "revoke":
+		return cmd.revoke(args)
+	case "public", "private":
+		return cmd.visibility(name == "public", args)
+	case "check":
+		return cmd.check(args)
+	case "who-can":
+		return cmd.whoCan(args)
+	}
+	return fmt.Errorf("unknown command %q", name)
+}
+
+func (cmd command) show(args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: show <col> <id>")
+	}
+	ent, err := cmd.load(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	if cmd.json {
+		return cmd.writeJSON(ent.Entity)
+	}
+	return cmd.writeTable(func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "entity\t%s\n", formatRef(ent.Ref()))
+		if ent.Parent != nil {
+			fmt.Fprintf(w, "parent\t%s\n", formatRef(*ent.Parent))
+		}
+		if ent.Creator != nil {
+			fmt.Fprintf(w, "creator\t%s\n", formatRef(*ent.Creator))
+		}
+		fmt.Fprintf(w, "public\t%t\n", ent.Public)
+		for _, perm := range acmogo.Permissions() {
+			for _, ref := range ent.References(perm) {
+				fmt.Fprintf(w, "%s\t%s\n", perm, formatRef(ref))
+			}
+		}
+		for _, grant := range ent.Timed {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", grant.Permission, formatRef(grant.Ref), formatPeriod(grant))
+		}
+		for _, ref := range ent.Denied {
+			fmt.Fprintf(w, "denied\t%s\n", formatRef(ref))
+		}
+		if ent.Trashed() {
+			fmt.Fprintf(w, "deleted\t%s\n", ent.DeletedAt.Format(time.RFC3339))
+		}
+	})
+}
+
+func (cmd command) grant(args []string) error {
+	if len(args) < 4 {
+		return errors.New("usage: grant <permission> <col> <id> <principal>...")
+	}
+	perm := acmogo.Permission(args[0])
+	ref, err := parseRef(args[1], args[2])
+	if err != nil {
+		return err
+	}
+	principals, err := parsePrincipals(args[3:])
+	if err != nil {
+		return err
+	}
+	a, err := cmd.auditor()
+	if err != nil {
+		return err
+	}
+	return a.PersistPermit(ref, perm, principals...)
+}
+
+func (cmd command) revoke(args []string) error {
+	if len(args) < 3 {
+		return errors.New("usage: revoke <col> <id> <principal>...")
+	}
+	ref, err := parseRef(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	principals, err := parsePrincipals(args[2:])
+	if err != nil {
+		return err
+	}
+	a, err := cmd.auditor()
+	if err != nil {
+		return err
+	}
+	return a.PersistClearAccessControl(ref, principals...)
+}
+
+func (cmd command) visibility(public bool, args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: public|private <col> <id>")
+	}
+	ref, err := parseRef(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	a, err := cmd.auditor()
+	if err != nil {
+		return err
+	}
+	if public {
+		return a.PersistPublic(ref)
+	}
+	return a.PersistPrivate(ref)
+}
+
+// auditor returns the Auditor recording the changes of cmd as its actor.
+func (cmd command) auditor() (acmogo.Auditor, error) {
+	if cmd.actor == nil {
+		return acmogo.Auditor{}, errNoActor
+	}
+	return cmd.p.NewAuditor(*cmd.actor), nil
+}
+
+func (cmd command) check(args []string) error {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	perm := fs.String("p", string(acmogo.Read), "permission to check")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	args = fs.Args()
+	if len(args) < 3 {
+		return errors.New("usage: check [-p permission] <col> <id> <principal>...")
+	}
+	ref, err := parseRef(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	principals, err := parsePrincipals(args[2:])
+	if err != nil {
+		return err
+	}
+	direct := len(cmd.memberships) == 0
+	if !direct {
+		principals, err = acmogo.ResolvePrincipals(cmd.p.NewMembershipResolver(cmd.memberships...), principals...)
+		if err != nil {
+			return err
+		}
+	}
+	d, err := cmd.p.Explain(ref, acmogo.Permission(*perm), principals...)
+	if err != nil {
+		return err
+	}
+	if cmd.json {
+		err = cmd.writeJSON(decision{Decision: d, DirectOnly: direct})
+	} else {
+		err = cmd.writeTable(func(w *tabwriter.Writer) {
+			fmt.Fprintf(w, "permission\t%s\n", d.Permission)
+			fmt.Fprintf(w, "permitted\t%t\n", d.Permitted)
+			if direct {
+				fmt.Fprintf(w, "principals\tdirect grants only, groups not resolved\n")
+			} else {
+				for _, ref := range d.Refs {
+					fmt.Fprintf(w, "principal\t%s\n", formatRef(ref))
+				}
+			}
+			if d.Match != nil {
+				fmt.Fprintf(w, "match\t%s\n", formatRef(*d.Match))
+			}
+			if d.Via != "" {
+				fmt.Fprintf(w, "via\t%s\n", d.Via)
+			}
+			if d.Reason != "" {
+				fmt.Fprintf(w, "reason\t%s\n", d.Reason)
+			}
+		})
+	}
+	if err == nil && !d.Permitted {
+		return errNotPermitted
+	}
+	return err
+}
+
+func (cmd command) whoCan(args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: who-can <col> <id>")
+	}
+	ent, err := cmd.load(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	ac, err := ent.InheritedAC(cmd.p.Loader())
+	if err != nil {
+		return err
+	}
+
+	var principals []acmogo.Reference
+	if ac.Creator != nil {
+		principals = append(principals, *ac.Creator)
+	}
+	for _, perm := range acmogo.Permissions() {
+		principals = append(principals, ac.References(perm)...)
+	}
+	for _, grant := range ac.Timed {
+		principals = append(principals, grant.Ref)
+	}
+	resolve := func(ref acmogo.Reference) ([]acmogo.Referencer, error) {
+		return []acmogo.Referencer{ref}, nil
+	}
+	if len(cmd.memberships) > 0 {
+		res := cmd.p.NewMembershipResolver(cmd.memberships...)
+		members, err := cmd.members(principals)
+		if err != nil {
+			return err
+		}
+		principals = append(principals, members...)
+		resolve = func(ref acmogo.Reference) ([]acmogo.Referencer, error) {
+			return acmogo.ResolvePrincipals(res, ref)
+		}
+	}
+	principals = acmogo.DedupReferenceList(principals)
+
+	holders := []holder{}
+	for _, perm := range acmogo.Permissions() {
+		if perm == acmogo.Read && ac.Public {
+			holders = append(holders, holder{Permission: perm, Via: acmogo.ViaPublic})
+		}
+		for i, principal := range principals {
+			refs, err := resolve(principal)
+			if err != nil {
+				return err
+			}
+			d := ac.Explain(perm, refs...)
+			// everyone holding read of a public entity is listed as *
+			if !d.Permitted || d.Via == acmogo.ViaPublic {
+				continue
+			}
+			h := holder{Permission: perm, Principal: &principals[i], Via: d.Via}
+			if d.Match != nil && *d.Match != principal {
+				h.Group = d.Match
+			}
+			if d.Grant != nil && !d.Grant.ExpiresAt.IsZero() {
+				h.ExpiresAt = &d.Grant.ExpiresAt
+			}
+			holders = append(holders, h)
+		}
+	}
+
+	if cmd.json {
+		return cmd.writeJSON(holders)
+	}
+	return cmd.writeTable(func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "PERMISSION\tPRINCIPAL\tVIA\tGROUP\tEXPIRES")
+		for _, h := range holders {
+			principal, group, expires := "*", "", ""
+			if h.Principal != nil {
+				principal = formatRef(*h.Principal)
+			}
+			if h.Group != nil {
+				group = formatRef(*h.Group)
+			}
+			if h.ExpiresAt != nil {
+				expires = h.ExpiresAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", h.Permission, principal, h.Via, group, expires)
+		}
+		if len(cmd.memberships) == 0 {
+			fmt.Fprintln(w, "direct grants only, members of groups not listed")
+		}
+	})
+}
+
+// members returns the principals that are members of groups,
+// directly or through other groups, according to cmd.memberships.
+func (cmd command) members(groups []acmogo.Reference) ([]acmogo.Reference, error) {
+	var members []acmogo.Reference
+	seen := make(map[acmogo.Reference]bool)
+	for len(groups) > 0 {
+		group := groups[0]
+		groups = groups[1:]
+		for _, m := range cmd.memberships {
+			var value interface{} = group
+			if m.GroupCol != "" {
+				if group.Col != m.GroupCol {
+					continue
+				}
+				value = group.ID
+			}
+			var found []acmogo.Entity
+			if err := cmd.p.Store.Find(m.Col, acmogo.Map{m.Field: value}, acmogo.Map{"_id": 1}, &found); err != nil {
+				return nil, err
+			}
+			for _, ent := range found {
+				member := acmogo.Reference{Col: m.Col, ID: ent.ID}
+				if !seen[member] {
+					seen[member] = true
+					members = append(members, member)
+					groups = append(groups, member)
+				}
+			}
+		}
+	}
+	return members, nil
+}
+
+func (cmd command) load(col, id string) (entity, error) {
+	ref, err := parseRef(col, id)
+	if err != nil {
+		return entity{}, err
+	}
+	ent := entity{col: col}
+	ent.ID = ref.ID
+	err = cmd.p.RefreshEntity(&ent)
+	// unmarshalling zeroes the unexported collection name
+	ent.col = col
+	return ent, err
+}
+
+func (cmd command) writeJSON(v interface{}) error {
+	enc := json.NewEncoder(cmd.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func (cmd command) writeTable(rows func(w *tabwriter.Writer)) error {
+	w := tabwriter.NewWriter(cmd.out, 0, 4, 2, ' ', 0)
+	rows(w)
+	return w.Flush()
+}
+
+func parseRef(col, id string) (acmogo.Reference, error) {
+	if !bson.IsObjectIdHex(id) {
+		return acmogo.Reference{}, fmt.Errorf("invalid id %q", id)
+	}
+	ref := acmogo.Reference{Col: col, ID: bson.ObjectIdHex(id)}
+	return ref, ref.Validate()
+}
+
+// parsePrincipals parses principals written as <col>:<id>.
+func parsePrincipals(args []string) ([]acmogo.Referencer, error) {
+	principals := make([]acmogo.Referencer, 0, len(args))
+	for _, arg := range args {
+		ref, err := parsePrincipal(arg)
+		if err != nil {
+			return nil, err
+		}
+		principals = append(principals, ref)
+	}
+	return principals, nil
+}
+
+func parsePrincipal(arg string) (acmogo.Reference, error) {
+	i := strings.LastIndexByte(arg, ':')
+	if i < 0 {
+		return acmogo.Reference{}, fmt.Errorf("invalid principal %q, expected <col>:<id>", arg)
+	}
+	return parseRef(arg[:i], arg[i+1:])
+}
+
+func formatRef(ref acmogo.Reference) string {
+	return ref.Col + ":" + ref.ID.Hex()
+}
+
+func formatPeriod(grant acmogo.Grant) string {
+	from, until := "", ""
+	if !grant.NotBefore.IsZero() {
+		from = grant.NotBefore.Format(time.RFC3339)
+	}
+	if !grant.ExpiresAt.IsZero() {
+		until = grant.ExpiresAt.Format(time.RFC3339)
+	}
+	return from + ".." + until
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/crhntr/acmogo"
+	"github.com/crhntr/acmogo/memstore"
+	"github.com/globalsign/mgo/bson"
+)
+
+func TestCommand(t *testing.T) {
+	var out bytes.Buffer
+	admin := acmogo.Reference{Col: "user", ID: bson.NewObjectId()}
+	cmd := command{p: memstore.New().Persistence(), actor: &admin, out: &out}
+
+	post := acmogo.New()
+	post.SetCreator(acmogo.Reference{Col: "user", ID: bson.NewObjectId()})
+	cmd.p.InsertList(entity{Entity: post, col: "post"})
+
+	id := post.ID.Hex()
+	user := "user:" + bson.NewObjectId().Hex()
+	team := "team:" + bson.NewObjectId().Hex()
+
+	run := func(args ...string) error {
+		out.Reset()
+		return cmd.run(args)
+	}
+
+	if err := run("grant", "update", "post", id, user, team); err != nil {
+		t.Fatal(err)
+	}
+	if err := run("check", "-p", "update", "post", id, user); err != nil {
+		t.Errorf("expected update to be permitted: %s", err)
+	}
+	entries, err := cmd.p.ActorHistory(admin)
+	if err != nil || len(entries) != 1 || entries[0].Operation != acmogo.OpPermit || entries[0].Pending {
+		t.Errorf("expected the grant to be audited but got %+v (err: %v)", entries, err)
+	}
+	if !hasRow(out.String(), "via", "updaters") || !hasRow(out.String(), "principals", "direct", "grants", "only,", "groups", "not", "resolved") {
+		t.Errorf("expected check to say how update was granted but got %q", out.String())
+	}
+	if err := run("revoke", "post", id, user); err != nil {
+		t.Fatal(err)
+	}
+	if err := run("check", "post", id, user); err != errNotPermitted {
+		t.Errorf("expected read to be revoked but got %v", err)
+	}
+	if err := run("public", "post", id); err != nil {
+		t.Fatal(err)
+	}
+	if err := run("show", "post", id); err != nil {
+		t.Fatal(err)
+	}
+	if !hasRow(out.String(), "entity", "post:"+id) || !hasRow(out.String(), "public", "true") || !hasRow(out.String(), "update", team) {
+		t.Errorf("unexpected show output %q", out.String())
+	}
+
+	cmd.json = true
+	if err := run("who-can", "post", id); err != nil {
+		t.Fatal(err)
+	}
+	var holders []holder
+	if err := json.Unmarshal(out.Bytes(), &holders); err != nil {
+		t.Fatal(err)
+	}
+	// everyone holds read, the creator update and delete
+	// and the team update
+	if len(holders) != 4 {
+		t.Errorf("expected 4 holders but got %+v", holders)
+	}
+
+	if err := run("grant", "read", "post", id, "user"); err == nil {
+		t.Error("expected a malformed principal to be rejected")
+	}
+	if err := run("show", "post", bson.NewObjectId().Hex()); err != acmogo.ErrNotFound {
+		t.Errorf("expected not found but got %v", err)
+	}
+
+	cmd.actor = nil
+	if err := run("private", "post", id); err != errNoActor {
+		t.Errorf("expected a change without an actor to be refused but got %v", err)
+	}
+}
+
+func TestCommand_Membership(t *testing.T) {
+	var out bytes.Buffer
+	cmd := command{p: memstore.New().Persistence(), out: &out}
+
+	team := acmogo.Reference{Col: "team", ID: bson.NewObjectId()}
+	user := bson.NewObjectId()
+	cmd.p.Store.Insert("user", acmogo.Map{"_id": user, "teams": []bson.ObjectId{team.ID}})
+	post := acmogo.New()
+	post.PermitUpdate(team)
+	cmd.p.InsertList(entity{Entity: post, col: "post"})
+
+	run := func(args ...string) error {
+		out.Reset()
+		return cmd.run(args)
+	}
+
+	if err := run("check", "-p", "update", "post", post.ID.Hex(), "user:"+user.Hex()); err != errNotPermitted {
+		t.Errorf("expected update not to be permitted without memberships but got %v", err)
+	}
+
+	var memberships membershipFlag
+	if err := memberships.Set("user.teams=team"); err != nil {
+		t.Fatal(err)
+	}
+	if err := memberships.Set("user"); err == nil {
+		t.Error("expected a membership without a field to be rejected")
+	}
+	cmd.memberships = memberships
+
+	if err := run("check", "-p", "update", "post", post.ID.Hex(), "user:"+user.Hex()); err != nil {
+		t.Errorf("expected update to be permitted through the team: %s", err)
+	}
+	if !hasRow(out.String(), "match", formatRef(team)) {
+		t.Errorf("expected check to name the team but got %q", out.String())
+	}
+	if err := run("who-can", "post", post.ID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	if !hasRow(out.String(), "update", "user:"+user.Hex(), acmogo.ViaUpdaters, formatRef(team)) {
+		t.Errorf("expected who-can to list the member of the team but got %q", out.String())
+	}
+}
+
+// hasRow reports whether a line of the table out has exactly fields.
+func hasRow(out string, fields ...string) bool {
+	for _, line := range strings.Split(out, "\n") {
+		if strings.Join(strings.Fields(line), " ") == strings.Join(fields, " ") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+// Command acmogo inspects and edits the access control of stored entities.
+//
+// Usage:
+//
+//	acmogo [flags] show <col> <id>
+//	acmogo [flags] grant <permission> <col> <id> <principal>...
+//	acmogo [flags] revoke <col> <id> <principal>...
+//	acmogo [flags] public <col> <id>
+//	acmogo [flags] private <col> <id>
+//	acmogo [flags] check [-p permission] <col> <id> <principal>...
+//	acmogo [flags] who-can <col> <id>
+//
+// Principals are written as <col>:<id>, for example user:5c8a1d5b0000000000000000.
+// check exits with status 1 if the permission is not held.
+//
+// grant, revoke, public and private are recorded in the audit log as
+// made by the principal given with -actor, without which they refuse to run.
+//
+// Without -membership, check and who-can only consider the grants held by
+// the principals themselves. Each -membership col.field[=groupcol] flag
+// describes an acmogo.Membership: check then also considers the groups the
+// principals belong to, and who-can lists the members of the groups.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/crhntr/acmogo"
+	"github.com/globalsign/mgo"
+)
+
+func main() {
+	fs := flag.NewFlagSet("acmogo", flag.ExitOnError)
+	url := fs.String("url", envOr("ACMOGO_URL", "mongodb://localhost:27017"), "MongoDB connection string")
+	dbName := fs.String("db", os.Getenv("ACMOGO_DB"), "database name, if not given in the connection string")
+	timeout := fs.Duration("timeout", 10*time.Second, "timeout of the command")
+	jsonOutput := fs.Bool("json", false, "write JSON instead of a table")
+	actor := fs.String("actor", os.Getenv("ACMOGO_ACTOR"), "principal as <col>:<id> that changes are recorded as made by")
+	var memberships membershipFlag
+	fs.Var(&memberships, "membership", "group membership as col.field[=groupcol], may be repeated")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: acmogo [flags] show|grant|revoke|public|private|check|who-can ...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(os.Args[1:])
+
+	cmd := command{
+		memberships: memberships,
+		out:         os.Stdout,
+		json:        *jsonOutput,
+	}
+	if *actor != "" {
+		ref, err := parsePrincipal(*actor)
+		if err != nil {
+			fatal(err)
+		}
+		cmd.actor = &ref
+	}
+
+	session, err := mgo.DialWithTimeout(*url, *timeout)
+	if err != nil {
+		fatal(err)
+	}
+	defer session.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	cmd.p = acmogo.WithContext(ctx, session.DB(*dbName))
+	if err := cmd.run(fs.Args()); err != nil {
+		if err == errNotPermitted {
+			os.Exit(1)
+		}
+		fatal(err)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "acmogo:", err)
+	os.Exit(2)
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// command runs a subcommand against a Persistence.
+type command struct {
+	p           acmogo.Persistence
+	actor       *acmogo.Reference
+	memberships []acmogo.Membership
+	out         io.Writer
+	json        bool
+}
+
+// membershipFlag collects the -membership flags.
+type membershipFlag []acmogo.Membership
+
+func (f *membershipFlag) String() string {
+	list := make([]string, len(*f))
+	for i, m := range *f {
+		list[i] = m.Col + "." + m.Field
+		if m.GroupCol != "" {
+			list[i] += "=" + m.GroupCol
+		}
+	}
+	return strings.Join(list, ",")
+}
+
+func (f *membershipFlag) Set(value string) error {
+	m, err := parseMembership(value)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, m)
+	return nil
+}
+
+// parseMembership parses a membership written as col.field[=groupcol].
+func parseMembership(value string) (acmogo.Membership, error) {
+	var m acmogo.Membership
+	if i := strings.IndexByte(value, '='); i >= 0 {
+		value, m.GroupCol = value[:i], value[i+1:]
+	}
+	i := strings.IndexByte(value, '.')
+	if i <= 0 || i == len(value)-1 {
+		return m, fmt.Errorf("invalid membership %q, expected col.field[=groupcol]", value)
+	}
+	m.Col, m.Field = value[:i], value[i+1:]
+	return m, nil
+}
@@ -0,0 +1,23 @@
+package acmogo
+
+import "context"
+
+type contextKey int
+
+const (
+	principalsKey contextKey = iota
+	entityKey
+	actorKey
+)
+
+// ContextWithActor returns a copy of ctx carrying actor as
+// the principal access control changes are made on behalf of.
+func ContextWithActor(ctx context.Context, actor Referencer) context.Context {
+	return context.WithValue(ctx, actorKey, actor.Ref())
+}
+
+// ActorFromContext returns the actor stored by ContextWithActor.
+func ActorFromContext(ctx context.Context) (Reference, bool) {
+	actor, ok := ctx.Value(actorKey).(Reference)
+	return actor, ok
+}
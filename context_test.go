@@ -0,0 +1,82 @@
+package acmogo_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/crhntr/acmogo"
+	"github.com/crhntr/acmogo/memstore"
+)
+
+// cancelStore cancels its context after n inserts.
+type cancelStore struct {
+	*memstore.Store
+	n      int
+	cancel func()
+}
+
+func (s *cancelStore) Insert(col string, doc interface{}) error {
+	err := s.Store.Insert(col, doc)
+	if s.n--; s.n == 0 {
+		s.cancel()
+	}
+	return err
+}
+
+func TestPersistence_WithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := acmogo.Persistence{Store: &cancelStore{Store: memstore.New(), n: 2, cancel: cancel}}.WithContext(ctx)
+
+	post0 := Post{Entity: acmogo.New()}
+	post1 := Post{Entity: acmogo.New()}
+	post2 := Post{Entity: acmogo.New()}
+
+	if _, err := p.InsertList(post0, post1, post2); err != context.Canceled {
+		t.Errorf("expected the insert to be cancelled but got %v", err)
+	}
+	if err := p.RefreshEntity(&post0); err != context.Canceled {
+		t.Errorf("expected operations to fail after cancellation but got %v", err)
+	}
+
+	p = p.WithContext(context.Background())
+	if err := p.RefreshEntity(&post1); err != nil {
+		t.Errorf("expected inserts before cancellation to be stored: %s", err)
+	}
+	if err := p.RefreshEntity(&post2); err != acmogo.ErrNotFound {
+		t.Errorf("expected inserts after cancellation to be skipped but got %v", err)
+	}
+}
+
+func TestWithContext(t *testing.T) {
+	requireDB(t)
+
+	admin := User{Entity: acmogo.New()}
+	user0 := User{Entity: acmogo.New()}
+	post0 := Post{Entity: acmogo.New()}
+	acmogo.InsertList(db, post0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	auditor := acmogo.NewAuditor(db, user0).WithContext(acmogo.ContextWithActor(ctx, admin))
+	if err := auditor.PersistPermitRead(post0, user0); err != nil {
+		t.Fatal(err)
+	}
+	if !acmogo.WithContext(ctx, db).ReadPermitted(post0, user0) {
+		t.Error("read should be permitted before the deadline")
+	}
+	entries, err := acmogo.ActorHistory(db, admin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Target != post0.Ref() {
+		t.Errorf("expected the change to be recorded for the context actor but got %+v", entries)
+	}
+
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	if err := acmogo.WithContext(expired, db).PersistPublic(post0); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded but got %v", err)
+	}
+}
@@ -11,13 +11,25 @@ type Entity struct {
 	ID        bson.ObjectId `json:"_id" bson:"_id"`
 	AC        `json:"_ac" bson:"_ac"`
 	CreatedAt time.Time `json:"_createdAt" bson:"_createdAt"`
-	// UpdatedAt time.Time `json:"_updatedAt" bson:"_updatedAt"`
+	UpdatedAt time.Time `json:"_updatedAt" bson:"_updatedAt"`
+
+	// Version counts the updates made with UpdateEntity and UpdateEntityVersion.
+	Version int `json:"_v" bson:"_v"`
+
+	// Parent is the entity this one inherits access control from.
+	Parent *Reference `json:"_parent,omitempty" bson:"_parent,omitempty"`
+
+	// DeletedAt and DeletedBy are set while the entity is in the trash.
+	DeletedAt *time.Time `json:"_deletedAt,omitempty" bson:"_deletedAt,omitempty"`
+	DeletedBy *Reference `json:"_deletedBy,omitempty" bson:"_deletedBy,omitempty"`
 }
 
 func New() Entity {
+	now := time.Now()
 	return Entity{
 		ID:        bson.NewObjectId(),
-		CreatedAt: time.Now(),
+		CreatedAt: now,
+		UpdatedAt: now,
 	}
 }
 
@@ -32,7 +44,15 @@ type Referencer interface {
 
 type Map = bson.M
 
-var SelectEntityDoc = map[string]int{"_id": 1, ACPath: 1}
+var (
+	ParentPath    = "_parent"
+	UpdatedAtPath = "_updatedAt"
+	VersionPath   = "_v"
+	DeletedAtPath = "_deletedAt"
+	DeletedByPath = "_deletedBy"
+)
+
+var SelectEntityDoc = map[string]int{"_id": 1, ACPath: 1, ParentPath: 1, DeletedAtPath: 1}
 
 func (ref Reference) Validate() error {
 	if ref.Col == "" || !ref.ID.Valid() {
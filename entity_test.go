@@ -2,20 +2,20 @@ package acmogo_test
 
 import (
 	"flag"
+	"fmt"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/crhntr/acmogo"
+	"github.com/crhntr/acmogo/memstore"
 	"github.com/globalsign/mgo"
 	"github.com/globalsign/mgo/bson"
 )
 
 var (
-	dbName             = "mongox_entity_test"
-	databaseSession, _ = mgo.DialWithInfo(&mgo.DialInfo{
-		Database: dbName,
-		Addrs:    []string{":27017"},
-	})
+	dbName          = "mongox_entity_test"
+	databaseSession *mgo.Session
 )
 
 type mp map[string]interface{}
@@ -24,12 +24,43 @@ var db *mgo.Database
 
 func TestMain(m *testing.M) {
 	flag.Parse()
-	defer databaseSession.Close()
-	db = databaseSession.DB("")
-	os.Exit(m.Run())
+	session, err := mgo.DialWithInfo(&mgo.DialInfo{
+		Database: dbName,
+		Addrs:    []string{":27017"},
+		Timeout:  2 * time.Second,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "skipping tests that need MongoDB: %s\n", err)
+	} else {
+		databaseSession = session
+		db = session.DB("")
+	}
+	code := m.Run()
+	if session != nil {
+		session.Close()
+	}
+	os.Exit(code)
+}
+
+// requireDB skips tests that need a running mongod when none is available.
+// Authorization logic can be tested without one using memstore.
+func requireDB(t *testing.T) {
+	if db == nil {
+		t.Skip("MongoDB is not available")
+	}
+}
+
+// dropCollections removes the collections a test uses
+// without touching those of other tests.
+func dropCollections(cols ...string) {
+	for _, col := range cols {
+		db.C(col).DropCollection()
+	}
 }
 
 func TestEntity(t *testing.T) {
+	requireDB(t)
+
 	for name, test := range map[string]func(t *testing.T){
 		"ReadPermitted": testEntityReadPermitted,
 	} {
@@ -63,6 +94,8 @@ func TestEntity_Validate(t *testing.T) {
 }
 
 func TestInsertEntity(t *testing.T) {
+	requireDB(t)
+
 	user0 := User{Entity: acmogo.New()}
 	user1 := User{Entity: acmogo.New()}
 	team0 := Team{Entity: acmogo.New()}
@@ -77,6 +110,8 @@ func TestInsertEntity(t *testing.T) {
 }
 
 func TestRefreshEntity(t *testing.T) {
+	requireDB(t)
+
 	post0 := Post{Entity: acmogo.New()}
 	acmogo.InsertList(db, post0)
 	post0N := 101
@@ -92,6 +127,8 @@ func TestRefreshEntity(t *testing.T) {
 }
 
 func TestUpdateEntity(t *testing.T) {
+	requireDB(t)
+
 	post0 := Post{Entity: acmogo.New()}
 	acmogo.InsertList(db, post0)
 	post0N := 101
@@ -105,6 +142,8 @@ func TestUpdateEntity(t *testing.T) {
 }
 
 func TestPersistClearAccessControl(t *testing.T) {
+	requireDB(t)
+
 	post0 := Post{Entity: acmogo.New()}
 	user0 := User{Entity: acmogo.New()}
 
@@ -126,6 +165,8 @@ func TestPersistClearAccessControl(t *testing.T) {
 }
 
 func TestPersistPermitRead(t *testing.T) {
+	requireDB(t)
+
 	post0 := Post{Entity: acmogo.New()}
 	post1 := Post{Entity: acmogo.New()}
 	user0 := User{Entity: acmogo.New()}
@@ -157,6 +198,8 @@ func TestPersistPermitRead(t *testing.T) {
 }
 
 func TestPersistPermitUpdate(t *testing.T) {
+	requireDB(t)
+
 	post0 := Post{Entity: acmogo.New()}
 	post1 := Post{Entity: acmogo.New()}
 	user0 := User{Entity: acmogo.New()}
@@ -189,6 +232,8 @@ func TestPersistPermitUpdate(t *testing.T) {
 }
 
 func TestPersistPermitDelete(t *testing.T) {
+	requireDB(t)
+
 	post0 := Post{Entity: acmogo.New()}
 	post1 := Post{Entity: acmogo.New()}
 	user0 := User{Entity: acmogo.New()}
@@ -221,6 +266,8 @@ func TestPersistPermitDelete(t *testing.T) {
 }
 
 func TestPersistPermitDeleteDowngradeToPermitUpdate(t *testing.T) {
+	requireDB(t)
+
 	post0 := Post{Entity: acmogo.New()}
 	user0 := User{Entity: acmogo.New()}
 
@@ -241,6 +288,8 @@ func TestPersistPermitDeleteDowngradeToPermitUpdate(t *testing.T) {
 }
 
 func TestPersistPermitDeleteDowngradeToPermitRead(t *testing.T) {
+	requireDB(t)
+
 	post0 := Post{Entity: acmogo.New()}
 	user0 := User{Entity: acmogo.New()}
 
@@ -261,6 +310,8 @@ func TestPersistPermitDeleteDowngradeToPermitRead(t *testing.T) {
 }
 
 func TestPersistPermitUpdateDowngradeToPermitRead(t *testing.T) {
+	requireDB(t)
+
 	post0 := Post{Entity: acmogo.New()}
 	user0 := User{Entity: acmogo.New()}
 
@@ -281,6 +332,8 @@ func TestPersistPermitUpdateDowngradeToPermitRead(t *testing.T) {
 }
 
 func TestPersistPublic(t *testing.T) {
+	requireDB(t)
+
 	post0 := Post{Entity: acmogo.New()}
 	user0 := User{Entity: acmogo.New()}
 	user1 := User{Entity: acmogo.New()}
@@ -293,12 +346,14 @@ func TestPersistPublic(t *testing.T) {
 
 	acmogo.PersistPublic(db, post0)
 
-	if acmogo.ReadPermitted(db, post0, user0, user1) {
+	if !acmogo.ReadPermitted(db, post0, user0, user1) {
 		t.Error("read should be permitted")
 	}
 }
 
 func TestPersistPrivate(t *testing.T) {
+	requireDB(t)
+
 	post0 := Post{Entity: acmogo.New()}
 	user0 := User{Entity: acmogo.New()}
 	user1 := User{Entity: acmogo.New()}
@@ -316,6 +371,39 @@ func TestPersistPrivate(t *testing.T) {
 	}
 }
 
+func TestPersistence_PersistPublic(t *testing.T) {
+	store := memstore.New()
+	p := store.Persistence()
+	post0 := Post{Entity: acmogo.New()}
+	user0 := User{Entity: acmogo.New()}
+	p.InsertList(post0)
+
+	public := func() interface{} {
+		var doc bson.M
+		if err := store.FindId(PostCol, post0.ID, nil, &doc); err != nil {
+			t.Fatal(err)
+		}
+		ac, _ := doc["_ac"].(bson.M)
+		if _, ok := ac["p"]; ok {
+			t.Errorf("expected the visibility to be stored in pu but got %v", ac)
+		}
+		return ac["pu"]
+	}
+
+	if err := p.PersistPublic(post0); err != nil {
+		t.Fatal(err)
+	}
+	if public() != true || !p.ReadPermitted(post0, user0) {
+		t.Error("expected the post to be public")
+	}
+	if err := p.PersistPrivate(post0); err != nil {
+		t.Fatal(err)
+	}
+	if public() != false || p.ReadPermitted(post0, user0) {
+		t.Error("expected the post to be private")
+	}
+}
+
 func TestDedupReferenceList(t *testing.T) {
 	refs := []acmogo.Reference{
 		{Col: "A"},
@@ -341,3 +429,77 @@ func TestDedupReferenceList(t *testing.T) {
 		t.Errorf("expected %q but got %q", "ABDC", str)
 	}
 }
+
+func TestPersistPermit(t *testing.T) {
+	requireDB(t)
+
+	post0 := Post{Entity: acmogo.New()}
+	user0 := User{Entity: acmogo.New()}
+
+	acmogo.InsertList(db, post0, user0)
+
+	if err := acmogo.PersistPermit(db, post0, Comment, user0); err != nil {
+		t.Fatal(err)
+	}
+	if !acmogo.Permitted(db, post0, Comment, user0) {
+		t.Error("comment should be permitted")
+	}
+	if !acmogo.ReadPermitted(db, post0, user0) {
+		t.Error("read should be permitted")
+	}
+	if acmogo.UpdatePermitted(db, post0, user0) {
+		t.Error("update should not be permitted")
+	}
+
+	acmogo.PersistPermitUpdate(db, post0, user0)
+	if acmogo.Permitted(db, post0, Comment, user0) {
+		t.Error("comment should not be permitted after permitting update")
+	}
+
+	acmogo.PersistPermit(db, post0, Admin, user0)
+	if !acmogo.DeletePermitted(db, post0, user0) || !acmogo.Permitted(db, post0, Comment, user0) {
+		t.Error("admin should permit delete and comment")
+	}
+
+	acmogo.PersistClearAccessControl(db, post0, user0)
+	if acmogo.ReadPermitted(db, post0, user0) {
+		t.Error("read should not be permitted after clearing access control")
+	}
+
+	if err := acmogo.PersistPermit(db, post0, "unknown", user0); err != acmogo.ErrUnknownPermission {
+		t.Errorf("expected unknown permission error but got %v", err)
+	}
+}
+
+func TestPersistDeny(t *testing.T) {
+	requireDB(t)
+
+	post0 := Post{Entity: acmogo.New()}
+	user0 := User{Entity: acmogo.New()}
+	team0 := Team{Entity: acmogo.New()}
+
+	post0.Public = true
+	post0.PermitUpdate(team0)
+	acmogo.InsertList(db, post0, user0, team0)
+
+	if err := acmogo.PersistDeny(db, post0, user0); err != nil {
+		t.Fatal(err)
+	}
+	if acmogo.ReadPermitted(db, post0, user0) {
+		t.Error("read should not be permitted for a denied user on a public post")
+	}
+	if acmogo.UpdatePermitted(db, post0, user0, team0) {
+		t.Error("update should not be permitted for a denied user in a permitted team")
+	}
+	filter := acmogo.Map{"_id": post0.ID}
+	if n, _ := count(acmogo.FindReadPermitted(db, PostCol, []acmogo.Referencer{user0}, filter)); n != 0 {
+		t.Error("expected denied user not to find the post")
+	}
+
+	if err := acmogo.PersistUndeny(db, post0, user0); err != nil {
+		t.Fatal(err)
+	}
+	if !acmogo.UpdatePermitted(db, post0, user0, team0) {
+		t.Error("update should be permitted after undeny")
+	}
+}
@@ -0,0 +1,134 @@
+package acmogo
+
+import (
+	"time"
+
+	"github.com/globalsign/mgo"
+)
+
+// The ways a Decision can be reached.
+const (
+	ViaDenied   = "denied"
+	ViaPublic   = "public"
+	ViaCreator  = "creator"
+	ViaDeleters = "deleters"
+	ViaUpdaters = "updaters"
+	ViaReaders  = "readers"
+	ViaGrants   = "grants"
+	ViaTimed    = "timed"
+)
+
+// Decision describes how a permission check was decided.
+// When Permitted is false and Via is empty, Reason says why no reference matched.
+type Decision struct {
+	Entity     *Reference  `json:"entity,omitempty"`
+	Permission Permission  `json:"permission"`
+	Refs       []Reference `json:"refs"`
+	Permitted  bool        `json:"permitted"`
+
+	// Match is the reference that decided the check and Via the
+	// part of the AC it was found in. Granted is the permission
+	// Match holds, which may imply the one checked.
+	Match   *Reference `json:"match,omitempty"`
+	Via     string     `json:"via,omitempty"`
+	Granted Permission `json:"granted,omitempty"`
+	Grant   *Grant     `json:"grant,omitempty"`
+
+	Reason string `json:"reason,omitempty"`
+}
+
+// Explain is like Permitted but describes how the check was decided.
+func (ac AC) Explain(perm Permission, refs ...Referencer) Decision {
+	return ac.ExplainAt(perm, Now(), refs...)
+}
+
+// ExplainAt is like PermittedAt but describes how the check was decided.
+func (ac AC) ExplainAt(perm Permission, t time.Time, refs ...Referencer) Decision {
+	d := Decision{Permission: perm, Refs: refList(refs)}
+
+	for _, id := range d.Refs {
+		for _, idInSet := range ac.Denied {
+			if idInSet.Col == id.Col && idInSet.ID == id.ID {
+				return d.matched(false, id, ViaDenied, "")
+			}
+		}
+	}
+	if perm == Read && ac.Public {
+		d.Permitted, d.Via = true, ViaPublic
+		return d
+	}
+	granting := perm.granting()
+	if len(granting) == 0 {
+		d.Reason = "permission is not registered"
+		return d
+	}
+
+	for _, id := range d.Refs {
+		if ac.Creator != nil && ac.Creator.Col == id.Col && ac.Creator.ID == id.ID {
+			return d.matched(true, id, ViaCreator, "")
+		}
+
+		// granting lists the most powerful permissions first
+		for _, p := range granting {
+			for _, idInSet := range ac.References(p) {
+				if idInSet.Col == id.Col && idInSet.ID == id.ID {
+					return d.matched(true, id, p.via(), p)
+				}
+			}
+		}
+
+		for _, grant := range ac.Timed {
+			if grant.Ref.Col == id.Col && grant.Ref.ID == id.ID && grant.ActiveAt(t) && grant.Permission.Implies(perm) {
+				grant := grant
+				d.Grant = &grant
+				return d.matched(true, id, ViaTimed, grant.Permission)
+			}
+		}
+	}
+
+	if len(d.Refs) == 0 {
+		d.Reason = "no references were given"
+	} else {
+		d.Reason = "no reference holds the permission"
+	}
+	return d
+}
+
+// Explain loads the stored AC of entity, merged with those it inherits,
+// and describes whether any of refs holds perm. It returns ErrNotFound
+// if entity is not stored or is in the trash.
+func Explain(db *mgo.Database, entity Referencer, perm Permission, refs ...Referencer) (Decision, error) {
+	return mgoPersistence(db).Explain(entity, perm, refs...)
+}
+
+func (p Persistence) Explain(entity Referencer, perm Permission, refs ...Referencer) (Decision, error) {
+	ref := entity.Ref()
+	ent, err := p.loadLive(ref)
+	if err != nil {
+		return Decision{}, err
+	}
+	ac, err := ent.InheritedAC(p.Loader())
+	if err != nil {
+		return Decision{}, err
+	}
+	d := ac.Explain(perm, refs...)
+	d.Entity = &ref
+	return d, nil
+}
+
+func (d Decision) matched(permitted bool, match Reference, via string, granted Permission) Decision {
+	d.Permitted, d.Match, d.Via, d.Granted = permitted, &match, via, granted
+	return d
+}
+
+func (perm Permission) via() string {
+	switch perm {
+	case Read:
+		return ViaReaders
+	case Update:
+		return ViaUpdaters
+	case Delete:
+		return ViaDeleters
+	}
+	return ViaGrants
+}
@@ -0,0 +1,87 @@
+package acmogo_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/crhntr/acmogo"
+)
+
+func TestAC_Explain(t *testing.T) {
+	user0 := User{Entity: acmogo.New()}
+	user1 := User{Entity: acmogo.New()}
+	team0 := Team{Entity: acmogo.New()}
+	post0 := Post{Entity: acmogo.New()}
+
+	post0.SetCreator(user0.Ref())
+	post0.PermitRead(team0)
+
+	d := post0.Explain(acmogo.Update, user1, team0)
+	if d.Permitted || d.Via != "" || d.Reason == "" {
+		t.Errorf("expected update to be refused with a reason but got %+v", d)
+	}
+
+	d = post0.Explain(acmogo.Read, user1, team0)
+	if !d.Permitted || d.Via != acmogo.ViaReaders || *d.Match != team0.Ref() {
+		t.Errorf("expected read to be permitted through the team but got %+v", d)
+	}
+
+	d = post0.Explain(acmogo.Delete, user0)
+	if !d.Permitted || d.Via != acmogo.ViaCreator {
+		t.Errorf("expected delete to be permitted through the creator but got %+v", d)
+	}
+
+	post0.Permit(Admin, user1)
+	d = post0.Explain(Comment, user1)
+	if !d.Permitted || d.Via != acmogo.ViaGrants || d.Granted != Admin {
+		t.Errorf("expected comment to be permitted through admin but got %+v", d)
+	}
+
+	// react is registered after admin but implies less
+	post0.Grants[React] = []acmogo.Reference{user1.Ref()}
+	d = post0.Explain(acmogo.Read, user1)
+	if !d.Permitted || d.Granted != Admin {
+		t.Errorf("expected read to be explained by the more powerful admin grant but got %+v", d)
+	}
+
+	post0.Deny(user1)
+	d = post0.Explain(acmogo.Read, user1)
+	if d.Permitted || d.Via != acmogo.ViaDenied || *d.Match != user1.Ref() {
+		t.Errorf("expected read to be denied but got %+v", d)
+	}
+
+	buf, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded acmogo.Decision
+	if err := json.Unmarshal(buf, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Via != acmogo.ViaDenied || decoded.Permission != acmogo.Read || *decoded.Match != user1.Ref() {
+		t.Errorf("expected decision to survive a JSON round trip but got %s", buf)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	requireDB(t)
+
+	post0 := Post{Entity: acmogo.New()}
+	post1 := Post{Entity: acmogo.New()}
+	user0 := User{Entity: acmogo.New()}
+
+	post0.PermitUpdate(user0)
+	acmogo.InsertList(db, post0)
+
+	d, err := acmogo.Explain(db, post0, acmogo.Read, user0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.Permitted || d.Via != acmogo.ViaUpdaters || *d.Entity != post0.Ref() {
+		t.Errorf("expected read to be permitted through updaters but got %+v", d)
+	}
+
+	if _, err := acmogo.Explain(db, post1, acmogo.Read, user0); err != acmogo.ErrNotFound {
+		t.Errorf("expected not found but got %v", err)
+	}
+}
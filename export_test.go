@@ -0,0 +1,4 @@
+package acmogo
+
+// BulkFailures exposes bulkFailures to the tests.
+var BulkFailures = bulkFailures
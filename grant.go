@@ -0,0 +1,110 @@
+package acmogo
+
+import (
+	"time"
+
+	"github.com/globalsign/mgo"
+)
+
+// Now is the clock timed grants are checked against.
+// Replace it to test or to evaluate grants at another time.
+var Now = time.Now
+
+// Grant is a permission held by a reference for a limited time.
+// A zero NotBefore or ExpiresAt leaves that side of the period open.
+type Grant struct {
+	Ref        Reference  `json:"ref" bson:"ref"`
+	Permission Permission `json:"p" bson:"p"`
+	NotBefore  time.Time  `json:"nb,omitempty" bson:"nb,omitempty"`
+	ExpiresAt  time.Time  `json:"ex,omitempty" bson:"ex,omitempty"`
+}
+
+// ActiveAt reports whether the grant is in effect at t.
+func (grant Grant) ActiveAt(t time.Time) bool {
+	if !grant.NotBefore.IsZero() && t.Before(grant.NotBefore) {
+		return false
+	}
+	if !grant.ExpiresAt.IsZero() && !t.Before(grant.ExpiresAt) {
+		return false
+	}
+	return true
+}
+
+// PermitBetween grants perm to refs from notBefore until expiresAt.
+// Unlike Permit it does not replace the permissions refs already hold.
+func (ac *AC) PermitBetween(perm Permission, notBefore, expiresAt time.Time, refs ...Referencer) error {
+	if !perm.Registered() {
+		return ErrUnknownPermission
+	}
+	ac.Timed = append(ac.Timed, timedGrants(perm, notBefore, expiresAt, refs)...)
+	return nil
+}
+
+// PermitUntil grants perm to refs until expiresAt.
+func (ac *AC) PermitUntil(perm Permission, expiresAt time.Time, refs ...Referencer) error {
+	return ac.PermitBetween(perm, time.Time{}, expiresAt, refs...)
+}
+
+// PersistPermitBetween grants perm to entities on the stored entity
+// from notBefore until expiresAt.
+func PersistPermitBetween(db *mgo.Database, entity Referencer, perm Permission, notBefore, expiresAt time.Time, entities ...Referencer) error {
+	return mgoPersistence(db).PersistPermitBetween(entity, perm, notBefore, expiresAt, entities...)
+}
+
+func (p Persistence) PersistPermitBetween(entity Referencer, perm Permission, notBefore, expiresAt time.Time, entities ...Referencer) error {
+	if !perm.Registered() {
+		return ErrUnknownPermission
+	}
+	ref := entity.Ref()
+	return p.updateId(ref, Map{
+		"$push": Map{TimedPath: Map{"$each": timedGrants(perm, notBefore, expiresAt, entities)}},
+	})
+}
+
+// PersistPermitUntil grants perm to entities on the stored entity until expiresAt.
+func PersistPermitUntil(db *mgo.Database, entity Referencer, perm Permission, expiresAt time.Time, entities ...Referencer) error {
+	return mgoPersistence(db).PersistPermitUntil(entity, perm, expiresAt, entities...)
+}
+
+func (p Persistence) PersistPermitUntil(entity Referencer, perm Permission, expiresAt time.Time, entities ...Referencer) error {
+	return p.PersistPermitBetween(entity, perm, time.Time{}, expiresAt, entities...)
+}
+
+// SweepExpiredGrants removes the timed grants that expired
+// before Now() from every document in col.
+// It returns the number of documents updated.
+func SweepExpiredGrants(db *mgo.Database, col string) (int, error) {
+	return mgoPersistence(db).SweepExpiredGrants(col)
+}
+
+func (p Persistence) SweepExpiredGrants(col string) (int, error) {
+	expired := Map{"ex": Map{"$lte": Now()}}
+	return p.updateAll(col,
+		Map{TimedPath: Map{"$elemMatch": expired}},
+		Map{"$pull": Map{TimedPath: expired}},
+	)
+}
+
+// activeGrantFilter matches documents with a timed grant of one of perms
+// to one of refs that is in effect at t.
+func activeGrantFilter(perms []Permission, refs []Reference, t time.Time) Map {
+	return Map{TimedPath: Map{"$elemMatch": Map{
+		"ref": Map{"$in": refs},
+		"p":   Map{"$in": perms},
+		"nb":  Map{"$not": Map{"$gt": t}},
+		"ex":  Map{"$not": Map{"$lte": t}},
+	}}}
+}
+
+func timedGrants(perm Permission, notBefore, expiresAt time.Time, refs []Referencer) []Grant {
+	grants := make([]Grant, 0, len(refs))
+	for _, ref := range refs {
+		grants = append(grants, Grant{
+			Ref:        ref.Ref(),
+			Permission: perm,
+			NotBefore:  notBefore,
+			ExpiresAt:  expiresAt,
+		})
+	}
+	return grants
+}
@@ -0,0 +1,95 @@
+package acmogo_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/crhntr/acmogo"
+)
+
+func TestAC_PermitBetween(t *testing.T) {
+	user0 := User{Entity: acmogo.New()}
+	user1 := User{Entity: acmogo.New()}
+	post0 := Post{Entity: acmogo.New()}
+
+	monday := time.Date(2018, 10, 1, 0, 0, 0, 0, time.UTC)
+	friday := monday.AddDate(0, 0, 4)
+
+	if err := post0.PermitBetween(acmogo.Update, monday, friday, user0); err != nil {
+		t.Fatal(err)
+	}
+	post0.PermitUntil(acmogo.Read, friday, user1)
+
+	if post0.PermittedAt(acmogo.Update, monday.Add(-time.Second), user0) {
+		t.Error("update should not be permitted before the grant starts")
+	}
+	if !post0.PermittedAt(acmogo.Update, monday, user0) {
+		t.Error("update should be permitted when the grant starts")
+	}
+	if !post0.PermittedAt(acmogo.Read, monday.AddDate(0, 0, 1), user0) {
+		t.Error("read should be permitted while the update grant is active")
+	}
+	if post0.PermittedAt(acmogo.Delete, monday.AddDate(0, 0, 1), user0) {
+		t.Error("delete should not be permitted")
+	}
+	if post0.PermittedAt(acmogo.Update, friday, user0) {
+		t.Error("update should not be permitted once the grant expired")
+	}
+	if !post0.PermittedAt(acmogo.Read, monday.AddDate(-1, 0, 0), user1) {
+		t.Error("read should be permitted before expiry when not before is not set")
+	}
+	if post0.PermittedAt(acmogo.Update, monday, user1) {
+		t.Error("update should not be permitted")
+	}
+
+	now := acmogo.Now
+	defer func() { acmogo.Now = now }()
+	acmogo.Now = func() time.Time { return friday.Add(time.Hour) }
+	if post0.ReadPermitted(user0, user1) {
+		t.Error("read should not be permitted after every grant expired")
+	}
+
+	post0.ClearAccessControl(user0, user1)
+	if len(post0.Timed) != 0 {
+		t.Errorf("expected timed grants to be cleared but got %v", post0.Timed)
+	}
+}
+
+func TestPersistPermitBetween(t *testing.T) {
+	requireDB(t)
+
+	post0 := Post{Entity: acmogo.New()}
+	user0 := User{Entity: acmogo.New()}
+	user1 := User{Entity: acmogo.New()}
+
+	acmogo.InsertList(db, post0, user0, user1)
+
+	now := time.Now()
+	if err := acmogo.PersistPermitUntil(db, post0, acmogo.Update, now.Add(time.Hour), user0); err != nil {
+		t.Fatal(err)
+	}
+	acmogo.PersistPermitBetween(db, post0, acmogo.Read, now.Add(-time.Hour), now.Add(-time.Minute), user1)
+
+	if !acmogo.UpdatePermitted(db, post0, user0) {
+		t.Error("update should be permitted")
+	}
+	if acmogo.ReadPermitted(db, post0, user1) {
+		t.Error("read should not be permitted with an expired grant")
+	}
+
+	filter := acmogo.Map{"_id": post0.ID}
+	if n, _ := count(acmogo.FindUpdatePermitted(db, PostCol, []acmogo.Referencer{user0}, filter)); n != 1 {
+		t.Error("expected the post to be updatable through the timed grant")
+	}
+	if n, _ := count(acmogo.FindReadPermitted(db, PostCol, []acmogo.Referencer{user1}, filter)); n != 0 {
+		t.Error("expected the post not to be readable through the expired grant")
+	}
+
+	if _, err := acmogo.SweepExpiredGrants(db, PostCol); err != nil {
+		t.Fatal(err)
+	}
+	acmogo.RefreshEntity(db, &post0)
+	if len(post0.Timed) != 1 || post0.Timed[0].Ref != user0.Ref() {
+		t.Errorf("expected only the active grant to remain but got %v", post0.Timed)
+	}
+}
@@ -0,0 +1,127 @@
+package acmogo
+
+import (
+	"strings"
+
+	"github.com/globalsign/mgo"
+)
+
+// IndexPrefix starts the name of every index EnsureIndexes creates.
+// Indexes with the prefix that are no longer needed, for example after
+// ACPath changed, are reported as obsolete.
+var IndexPrefix = "acmogo_"
+
+// IndexReport lists the access control indexes of a collection by name.
+type IndexReport struct {
+	Created  []string `json:"created,omitempty"`
+	Existing []string `json:"existing,omitempty"`
+	Obsolete []string `json:"obsolete,omitempty"`
+	Dropped  []string `json:"dropped,omitempty"`
+}
+
+// IndexPaths returns the fields PermittedFilter, the inheritance
+// lookups, the creator updates and PurgeTrash query.
+// Each needs a (multikey) index; IndexKeys lists them.
+func IndexPaths() []string {
+	paths := []string{CreatorPath, PublicPath, TimedPath + ".ref", ParentPath, DeletedAtPath}
+	for _, perm := range Permissions() {
+		paths = append(paths, perm.Path())
+	}
+	return paths
+}
+
+// IndexKeys returns the keys of the indexes EnsureIndexes creates.
+// Every path of IndexPaths is indexed together with DeletedAtPath,
+// which PermittedFilter matches alongside each of them, so a query
+// excluding the trash is answered from the index alone.
+// DeletedAtPath is also indexed by itself for PurgeTrash.
+func IndexKeys() [][]string {
+	var keys [][]string
+	for _, path := range IndexPaths() {
+		if path == DeletedAtPath {
+			keys = append(keys, []string{path})
+			continue
+		}
+		keys = append(keys, []string{path, DeletedAtPath})
+	}
+	return keys
+}
+
+// EnsureIndexes creates the missing indexes with IndexKeys in each of
+// collections and reports which already existed and which indexes
+// created by an earlier layout are obsolete.
+func EnsureIndexes(db *mgo.Database, collections ...string) (map[string]IndexReport, error) {
+	return ensureIndexes(db, false, collections)
+}
+
+// DropObsoleteIndexes is like EnsureIndexes but also drops the obsolete indexes.
+func DropObsoleteIndexes(db *mgo.Database, collections ...string) (map[string]IndexReport, error) {
+	return ensureIndexes(db, true, collections)
+}
+
+func ensureIndexes(db *mgo.Database, drop bool, collections []string) (map[string]IndexReport, error) {
+	reports := make(map[string]IndexReport, len(collections))
+	for _, col := range collections {
+		c := db.C(col)
+		indexes, err := c.Indexes()
+		if err != nil && !isNamespaceNotFound(err) {
+			return reports, err
+		}
+
+		var report IndexReport
+		wanted := make(map[string]bool)
+		for _, key := range IndexKeys() {
+			wanted[strings.Join(key, ",")] = true
+			if name, ok := indexOn(indexes, key); ok {
+				report.Existing = append(report.Existing, name)
+				continue
+			}
+			name := indexName(key)
+			if err := c.EnsureIndex(mgo.Index{Key: key, Name: name, Background: true}); err != nil {
+				reports[col] = report
+				return reports, err
+			}
+			report.Created = append(report.Created, name)
+		}
+
+		for _, index := range indexes {
+			if !strings.HasPrefix(index.Name, IndexPrefix) || wanted[strings.Join(index.Key, ",")] {
+				continue
+			}
+			report.Obsolete = append(report.Obsolete, index.Name)
+			if !drop {
+				continue
+			}
+			if err := c.DropIndexName(index.Name); err != nil {
+				reports[col] = report
+				return reports, err
+			}
+			report.Dropped = append(report.Dropped, index.Name)
+		}
+		reports[col] = report
+	}
+	return reports, nil
+}
+
+func indexName(key []string) string {
+	return IndexPrefix + strings.Replace(strings.Join(key, "_"), ".", "_", -1)
+}
+
+// indexOn returns the name of an ascending index on exactly key.
+func indexOn(indexes []mgo.Index, key []string) (string, bool) {
+	for _, index := range indexes {
+		if strings.Join(index.Key, ",") == strings.Join(key, ",") {
+			return index.Name, true
+		}
+	}
+	return "", false
+}
+
+// isNamespaceNotFound reports whether err is returned
+// listing the indexes of a collection that does not exist.
+func isNamespaceNotFound(err error) bool {
+	if err, ok := err.(*mgo.QueryError); ok {
+		return err.Code == 26
+	}
+	return strings.Contains(err.Error(), "ns not found") || strings.Contains(err.Error(), "ns does not exist")
+}
@@ -0,0 +1,57 @@
+package acmogo_test
+
+import (
+	"testing"
+
+	"github.com/crhntr/acmogo"
+	"github.com/globalsign/mgo"
+)
+
+func TestEnsureIndexes(t *testing.T) {
+	requireDB(t)
+	dropCollections(PostCol, TeamCol)
+	defer dropCollections(PostCol, TeamCol)
+
+	// an index left behind by an older layout
+	if err := db.C(PostCol).EnsureIndex(mgo.Index{Key: []string{"_ac.p"}, Name: acmogo.IndexPrefix + "_ac_p"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.C(PostCol).EnsureIndex(mgo.Index{Key: []string{acmogo.ReadersPath, acmogo.DeletedAtPath}, Name: "readers"}); err != nil {
+		t.Fatal(err)
+	}
+
+	reports, err := acmogo.EnsureIndexes(db, PostCol, TeamCol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := len(acmogo.IndexKeys())
+	if r := reports[PostCol]; len(r.Existing) != 1 || len(r.Created) != paths-1 || len(r.Obsolete) != 1 || len(r.Dropped) != 0 {
+		t.Errorf("unexpected report for %s: %+v", PostCol, r)
+	}
+	if r := reports[TeamCol]; len(r.Created) != paths {
+		t.Errorf("unexpected report for %s: %+v", TeamCol, r)
+	}
+
+	reports, err = acmogo.DropObsoleteIndexes(db, PostCol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := reports[PostCol]; len(r.Existing) != paths || len(r.Created) != 0 || len(r.Dropped) != 1 {
+		t.Errorf("unexpected report after dropping: %+v", r)
+	}
+	if reports, _ = acmogo.EnsureIndexes(db, PostCol); len(reports[PostCol].Obsolete) != 0 {
+		t.Errorf("expected the obsolete index to be gone but got %+v", reports[PostCol])
+	}
+}
+
+func TestIndexKeys(t *testing.T) {
+	keys := acmogo.IndexKeys()
+	if len(keys) != len(acmogo.IndexPaths()) {
+		t.Fatalf("expected an index for every path but got %v", keys)
+	}
+	for _, key := range keys {
+		if key[len(key)-1] != acmogo.DeletedAtPath {
+			t.Errorf("expected %v to end with %s", key, acmogo.DeletedAtPath)
+		}
+	}
+}
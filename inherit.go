@@ -0,0 +1,136 @@
+package acmogo
+
+import (
+	"errors"
+
+	"github.com/globalsign/mgo"
+)
+
+// MaxInheritanceDepth is the number of ancestors
+// InheritedAC walks before giving up.
+var MaxInheritanceDepth = 16
+
+var (
+	ErrInheritanceCycle = errors.New("inheritance cycle")
+	ErrInheritanceDepth = errors.New("inheritance too deep")
+)
+
+// EntityLoader loads the SelectEntityDoc fields of the document ref points to.
+// It should return ErrNotFound if there is no such document.
+type EntityLoader func(ref Reference) (Entity, error)
+
+// DatabaseLoader returns an EntityLoader reading from db.
+func DatabaseLoader(db *mgo.Database) EntityLoader {
+	return mgoPersistence(db).Loader()
+}
+
+// Loader returns an EntityLoader reading from the Store.
+func (p Persistence) Loader() EntityLoader {
+	return p.loadEntity
+}
+
+func (ent *Entity) SetParent(parent Reference) error {
+	if err := parent.Validate(); err != nil {
+		return err
+	}
+	ent.Parent = &parent
+	return nil
+}
+
+// InheritedAC returns the AC of ent merged with the ACs of its ancestors.
+// Walking up the chain stops at an AC with NoInherit set or at an ancestor
+// that no longer exists. The creators of ancestors are granted every permission.
+func (ent Entity) InheritedAC(load EntityLoader) (AC, error) {
+	ac := ent.AC.clone()
+	if ent.NoInherit || ent.Parent == nil {
+		return ac, nil
+	}
+	if err := ac.inherit(load, *ent.Parent); err != nil {
+		return AC{}, err
+	}
+	return ac, nil
+}
+
+// inherit merges the ACs of parent and its ancestors into ac.
+func (ac *AC) inherit(load EntityLoader, parent Reference) error {
+	visited := make(map[Reference]bool)
+	for next := &parent; next != nil; {
+		if visited[*next] {
+			return ErrInheritanceCycle
+		}
+		if len(visited) >= MaxInheritanceDepth {
+			return ErrInheritanceDepth
+		}
+		visited[*next] = true
+
+		p, err := load(*next)
+		if err == ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		ac.merge(p.AC)
+		if p.NoInherit {
+			return nil
+		}
+		next = p.Parent
+	}
+	return nil
+}
+
+// InheritedPermitted reports whether any of refs holds perm on ent
+// or, through inheritance, on one of its ancestors.
+func (ent Entity) InheritedPermitted(load EntityLoader, perm Permission, refs ...Referencer) (bool, error) {
+	ac, err := ent.InheritedAC(load)
+	if err != nil {
+		return false, err
+	}
+	return ac.Permitted(perm, refs...), nil
+}
+
+// PersistParent sets the parent of the stored entity.
+func PersistParent(db *mgo.Database, entity Referencer, parent Referencer) error {
+	return mgoPersistence(db).PersistParent(entity, parent)
+}
+
+func (p Persistence) PersistParent(entity Referencer, parent Referencer) error {
+	ref, parentRef := entity.Ref(), parent.Ref()
+	if err := parentRef.Validate(); err != nil {
+		return err
+	}
+	return p.updateId(ref, Map{
+		"$set": Map{ParentPath: parentRef},
+	})
+}
+
+// merge adds the grants of parent to ac. ac should be a clone
+// so appending does not modify the lists of the AC it was cloned from.
+func (ac *AC) merge(parent AC) {
+	ac.Public = ac.Public || parent.Public
+	for _, perm := range Permissions() {
+		refs := parent.References(perm)
+		if parent.Creator != nil {
+			refs = append(refs[:len(refs):len(refs)], *parent.Creator)
+		}
+		if len(refs) > 0 {
+			ac.setReferences(perm, append(ac.References(perm), refs...))
+		}
+	}
+	ac.Timed = append(ac.Timed, parent.Timed...)
+	ac.Denied = append(ac.Denied, parent.Denied...)
+}
+
+func (ac AC) clone() AC {
+	c := ac
+	c.Readers = append([]Reference(nil), ac.Readers...)
+	c.Updaters = append([]Reference(nil), ac.Updaters...)
+	c.Deleters = append([]Reference(nil), ac.Deleters...)
+	c.Timed = append([]Grant(nil), ac.Timed...)
+	c.Denied = append([]Reference(nil), ac.Denied...)
+	c.Grants = make(map[Permission][]Reference, len(ac.Grants))
+	for perm, refs := range ac.Grants {
+		c.Grants[perm] = append([]Reference(nil), refs...)
+	}
+	return c
+}
@@ -0,0 +1,146 @@
+package acmogo_test
+
+import (
+	"testing"
+
+	"github.com/crhntr/acmogo"
+	"github.com/crhntr/acmogo/memstore"
+)
+
+func TestEntity_InheritedAC(t *testing.T) {
+	const (
+		OrgCol     = "org"
+		ProjectCol = "project"
+	)
+	user0 := User{Entity: acmogo.New()}
+	user1 := User{Entity: acmogo.New()}
+	user2 := User{Entity: acmogo.New()}
+
+	org := acmogo.New()
+	project := acmogo.New()
+	post := acmogo.New()
+
+	orgRef := acmogo.Reference{Col: OrgCol, ID: org.ID}
+	projectRef := acmogo.Reference{Col: ProjectCol, ID: project.ID}
+
+	org.SetCreator(user2.Ref())
+	project.PermitUpdate(user0)
+	project.SetParent(orgRef)
+	post.SetParent(projectRef)
+	post.PermitRead(user1)
+
+	entities := map[acmogo.Reference]acmogo.Entity{orgRef: org, projectRef: project}
+	load := func(ref acmogo.Reference) (acmogo.Entity, error) {
+		ent, ok := entities[ref]
+		if !ok {
+			return ent, acmogo.ErrNotFound
+		}
+		return ent, nil
+	}
+
+	if permitted, err := post.InheritedPermitted(load, acmogo.Update, user0); err != nil || !permitted {
+		t.Errorf("update should be inherited from the project (err: %v)", err)
+	}
+	if permitted, _ := post.InheritedPermitted(load, acmogo.Delete, user2); !permitted {
+		t.Error("delete should be inherited from the organization creator")
+	}
+	if permitted, _ := post.InheritedPermitted(load, acmogo.Update, user1); permitted {
+		t.Error("update should not be permitted for a post reader")
+	}
+	if post.UpdatePermitted(user0) || len(post.Updaters) != 0 {
+		t.Error("inheriting should not modify the entity")
+	}
+
+	project.NoInherit = true
+	entities[projectRef] = project
+	if permitted, _ := post.InheritedPermitted(load, acmogo.Delete, user2); permitted {
+		t.Error("the project should not inherit from the organization")
+	}
+	if permitted, _ := post.InheritedPermitted(load, acmogo.Update, user0); !permitted {
+		t.Error("update should still be inherited from the project")
+	}
+
+	project.NoInherit = false
+	org.SetParent(projectRef)
+	entities[projectRef], entities[orgRef] = project, org
+	if _, err := post.InheritedAC(load); err != acmogo.ErrInheritanceCycle {
+		t.Errorf("expected inheritance cycle error but got %v", err)
+	}
+
+	delete(entities, orgRef)
+	project.SetParent(orgRef)
+	entities[projectRef] = project
+	if permitted, err := post.InheritedPermitted(load, acmogo.Update, user0); err != nil || !permitted {
+		t.Errorf("a missing ancestor should end the chain (err: %v)", err)
+	}
+}
+
+func TestPermittedInherited(t *testing.T) {
+	requireDB(t)
+
+	user0 := User{Entity: acmogo.New()}
+	team0 := Team{Entity: acmogo.New()}
+	post0 := Post{Entity: acmogo.New()}
+
+	team0.PermitDelete(user0)
+	acmogo.InsertList(db, team0, post0)
+
+	if acmogo.DeletePermitted(db, post0, user0) {
+		t.Error("delete should not be permitted before the parent is set")
+	}
+	if err := acmogo.PersistParent(db, post0, team0); err != nil {
+		t.Fatal(err)
+	}
+	if !acmogo.DeletePermitted(db, post0, user0) {
+		t.Error("delete should be inherited from the parent")
+	}
+
+	d, err := acmogo.Explain(db, post0, acmogo.Read, user0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.Permitted || d.Via != acmogo.ViaDeleters {
+		t.Errorf("expected read to be permitted through inherited deleters but got %+v", d)
+	}
+}
+
+func TestPersistence_FindPermittedInherited(t *testing.T) {
+	p := memstore.New().Persistence()
+	user0 := User{Entity: acmogo.New()}
+	team0 := Team{Entity: acmogo.New()}
+	team1 := Team{Entity: acmogo.New()}
+	post0 := Post{Entity: acmogo.New(), N: 0}
+	post1 := Post{Entity: acmogo.New(), N: 1}
+	post2 := Post{Entity: acmogo.New(), N: 2}
+	post3 := Post{Entity: acmogo.New(), N: 3}
+	post4 := Post{Entity: acmogo.New(), N: 4}
+
+	team0.PermitRead(user0)
+	team1.Deny(user0)
+	post0.SetParent(team0.Ref())
+	post1.SetParent(team0.Ref())
+	post1.Deny(user0)
+	post2.SetParent(team0.Ref())
+	post2.NoInherit = true
+	post3.SetParent(team1.Ref())
+	post3.PermitRead(user0)
+	post4.PermitRead(user0)
+	p.InsertList(team0, team1, post0, post1, post2, post3, post4)
+
+	var posts []Post
+	if err := p.FindPermitted(PostCol, acmogo.Read, []acmogo.Referencer{user0}, nil, &posts); err != nil {
+		t.Fatal(err)
+	}
+	found := make(map[acmogo.Reference]bool)
+	for _, post := range posts {
+		found[post.Ref()] = true
+	}
+	for _, post := range []Post{post0, post1, post2, post3, post4} {
+		if found[post.Ref()] != p.ReadPermitted(post, user0) {
+			t.Errorf("expected FindPermitted to agree with ReadPermitted on post %d", post.N)
+		}
+	}
+	if len(posts) != 2 || !found[post0.Ref()] || !found[post4.Ref()] {
+		t.Errorf("expected the inheriting post and the directly readable post but got %d posts", len(posts))
+	}
+}
@@ -0,0 +1,281 @@
+package memstore
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+)
+
+// match reports whether doc satisfies filter. It fails on
+// query operators the package does not implement.
+func match(doc bson.M, filter bson.M) (bool, error) {
+	for key, cond := range filter {
+		var matched bool
+		var err error
+		switch key {
+		case "$and", "$or", "$nor":
+			filters, _ := cond.([]interface{})
+			matched, err = matchLogical(doc, key, filters)
+		default:
+			if strings.HasPrefix(key, "$") {
+				return false, fmt.Errorf("memstore: unsupported query operator %s", key)
+			}
+			matched, err = matchField(lookup(doc, key), cond)
+		}
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchLogical(doc bson.M, op string, filters []interface{}) (bool, error) {
+	for _, f := range filters {
+		sub, _ := f.(bson.M)
+		matched, err := match(doc, sub)
+		switch {
+		case err != nil:
+			return false, err
+		case op == "$and" && !matched:
+			return false, nil
+		case op == "$or" && matched:
+			return true, nil
+		case op == "$nor" && matched:
+			return false, nil
+		}
+	}
+	return op != "$or", nil
+}
+
+// matchField reports whether the values found at a path satisfy cond,
+// which is either an operator document or a value to compare with.
+func matchField(values []interface{}, cond interface{}) (bool, error) {
+	ops, ok := cond.(bson.M)
+	if !ok || !isOperatorDoc(ops) {
+		return anyEqual(values, cond), nil
+	}
+	for op, arg := range ops {
+		matched, err := matchOperator(values, op, arg)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchOperator(values []interface{}, op string, arg interface{}) (bool, error) {
+	switch op {
+	case "$eq":
+		return anyEqual(values, arg), nil
+	case "$ne":
+		return !anyEqual(values, arg), nil
+	case "$in":
+		list, _ := arg.([]interface{})
+		for _, v := range list {
+			if anyEqual(values, v) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "$nin":
+		in, err := matchOperator(values, "$in", arg)
+		return !in, err
+	case "$gt", "$gte", "$lt", "$lte":
+		for _, v := range expand(values) {
+			c, ok := compare(v, arg)
+			if !ok {
+				continue
+			}
+			switch {
+			case op == "$gt" && c > 0, op == "$gte" && c >= 0,
+				op == "$lt" && c < 0, op == "$lte" && c <= 0:
+				return true, nil
+			}
+		}
+		return false, nil
+	case "$exists":
+		exists, _ := arg.(bool)
+		return (len(values) > 0) == exists, nil
+	case "$not":
+		matched, err := matchField(values, arg)
+		return !matched, err
+	case "$size":
+		for _, v := range values {
+			if list, ok := v.([]interface{}); ok {
+				if n, ok := number(arg); ok && float64(len(list)) == n {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	case "$elemMatch":
+		cond, _ := arg.(bson.M)
+		for _, v := range values {
+			list, ok := v.([]interface{})
+			if !ok {
+				continue
+			}
+			for _, elem := range list {
+				var matched bool
+				var err error
+				if isOperatorDoc(cond) {
+					matched, err = matchField([]interface{}{elem}, cond)
+				} else if sub, ok := elem.(bson.M); ok {
+					matched, err = match(sub, cond)
+				}
+				if err != nil || matched {
+					return matched, err
+				}
+			}
+		}
+		return false, nil
+	}
+	return false, fmt.Errorf("memstore: unsupported query operator %s", op)
+}
+
+func isOperatorDoc(doc bson.M) bool {
+	if len(doc) == 0 {
+		return false
+	}
+	for key := range doc {
+		if !strings.HasPrefix(key, "$") {
+			return false
+		}
+	}
+	return true
+}
+
+// lookup returns every value found at the dotted path in doc.
+// Like MongoDB it descends into the elements of arrays it meets on the way.
+func lookup(doc interface{}, path string) []interface{} {
+	key, rest := path, ""
+	if i := strings.IndexByte(path, '.'); i >= 0 {
+		key, rest = path[:i], path[i+1:]
+	}
+	switch d := doc.(type) {
+	case bson.M:
+		v, ok := d[key]
+		if !ok {
+			return nil
+		}
+		if rest == "" {
+			return []interface{}{v}
+		}
+		return lookup(v, rest)
+	case []interface{}:
+		var values []interface{}
+		for _, elem := range d {
+			if _, isDoc := elem.(bson.M); isDoc {
+				values = append(values, lookup(elem, path)...)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// anyEqual reports whether one of values, or an element of an array
+// among them, equals v.
+func anyEqual(values []interface{}, v interface{}) bool {
+	// like MongoDB, null matches a missing field
+	if v == nil && len(values) == 0 {
+		return true
+	}
+	for _, value := range values {
+		if equal(value, v) {
+			return true
+		}
+		if list, ok := value.([]interface{}); ok {
+			for _, elem := range list {
+				if equal(elem, v) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func expand(values []interface{}) []interface{} {
+	var expanded []interface{}
+	for _, value := range values {
+		if list, ok := value.([]interface{}); ok {
+			expanded = append(expanded, list...)
+			continue
+		}
+		expanded = append(expanded, value)
+	}
+	return expanded
+}
+
+func equal(a, b interface{}) bool {
+	if c, ok := compare(a, b); ok {
+		return c == 0
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// compare orders values of the same BSON type.
+// ok is false if they can not be compared.
+func compare(a, b interface{}) (c int, ok bool) {
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	}
+	switch x := a.(type) {
+	case string:
+		y, ok := b.(string)
+		return strings.Compare(x, y), ok
+	case bson.ObjectId:
+		y, ok := b.(bson.ObjectId)
+		return bytes.Compare([]byte(x), []byte(y)), ok
+	case time.Time:
+		y, ok := b.(time.Time)
+		// MongoDB stores milliseconds
+		x, y = x.Truncate(time.Millisecond), y.Truncate(time.Millisecond)
+		switch {
+		case x.Before(y):
+			return -1, ok
+		case x.After(y):
+			return 1, ok
+		}
+		return 0, ok
+	case bool:
+		y, ok := b.(bool)
+		switch {
+		case x == y:
+			return 0, ok
+		case !x:
+			return -1, ok
+		}
+		return 1, ok
+	}
+	return 0, false
+}
+
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
@@ -0,0 +1,229 @@
+// Package memstore implements acmogo.Store in memory so applications can
+// unit test their access control without a running mongod.
+//
+// It understands the subset of the MongoDB query and update languages
+// acmogo relies on: the comparison, logical, $exists and $elemMatch query
+// operators and the $set, $unset, $inc, $push, $addToSet, $pull and $pullAll
+// update operators, including dotted paths through embedded documents.
+// Other operators make the operation fail with an error.
+package memstore
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+
+	"github.com/crhntr/acmogo"
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+)
+
+// Store is an acmogo.Store holding documents in memory.
+// The zero value is not usable; create one with New.
+type Store struct {
+	mu   sync.Mutex
+	cols map[string][]bson.M
+}
+
+var _ acmogo.Store = (*Store)(nil)
+
+func New() *Store {
+	return &Store{cols: make(map[string][]bson.M)}
+}
+
+// Persistence returns an acmogo.Persistence backed by s.
+func (s *Store) Persistence() acmogo.Persistence {
+	return acmogo.Persistence{Store: s}
+}
+
+// Insert stores doc in col. Like MongoDB it fails with a duplicate key
+// error, which mgo.IsDup recognises, if col already holds its _id.
+func (s *Store) Insert(col string, doc interface{}) error {
+	d, err := toDoc(doc)
+	if err != nil {
+		return err
+	}
+	id, ok := d["_id"]
+	if !ok {
+		id = bson.NewObjectId()
+		d["_id"] = id
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.cols[col] {
+		if equal(existing["_id"], id) {
+			return &mgo.LastError{Code: 11000, Err: "E11000 duplicate key error collection: " + col + " index: _id_"}
+		}
+	}
+	s.cols[col] = append(s.cols[col], d)
+	return nil
+}
+
+func (s *Store) FindId(col string, id bson.ObjectId, projection acmogo.Map, result interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i, err := s.find(col, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if i < 0 {
+		return acmogo.ErrNotFound
+	}
+	return fromDoc(project(s.cols[col][i], projection), result)
+}
+
+func (s *Store) UpdateId(col string, id bson.ObjectId, update acmogo.Map) error {
+	return s.Update(col, acmogo.Map{"_id": id}, update)
+}
+
+func (s *Store) Update(col string, selector, update acmogo.Map) error {
+	sel, err := toDoc(selector)
+	if err != nil {
+		return err
+	}
+	upd, err := toDoc(update)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i, err := s.find(col, sel)
+	if err != nil {
+		return err
+	}
+	if i < 0 {
+		return acmogo.ErrNotFound
+	}
+	updated, err := apply(s.cols[col][i], upd)
+	if err != nil {
+		return err
+	}
+	s.cols[col][i] = updated
+	return nil
+}
+
+// UpdateAll applies update to every document in col matching selector
+// and returns the number of documents updated.
+func (s *Store) UpdateAll(col string, selector, update acmogo.Map) (int, error) {
+	sel, err := toDoc(selector)
+	if err != nil {
+		return 0, err
+	}
+	upd, err := toDoc(update)
+	if err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for i, doc := range s.cols[col] {
+		matched, err := match(doc, sel)
+		if err != nil {
+			return n, err
+		}
+		if !matched {
+			continue
+		}
+		updated, err := apply(doc, upd)
+		if err != nil {
+			return n, err
+		}
+		s.cols[col][i] = updated
+		n++
+	}
+	return n, nil
+}
+
+// RemoveAll removes every document in col matching selector
+// and returns the number of documents removed.
+func (s *Store) RemoveAll(col string, selector acmogo.Map) (int, error) {
+	sel, err := toDoc(selector)
+	if err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := make([]bson.M, 0, len(s.cols[col]))
+	for _, doc := range s.cols[col] {
+		matched, err := match(doc, sel)
+		if err != nil {
+			return 0, err
+		}
+		if !matched {
+			kept = append(kept, doc)
+		}
+	}
+	n := len(s.cols[col]) - len(kept)
+	s.cols[col] = kept
+	return n, nil
+}
+
+// Find loads every document in col matching filter into results,
+// which must be a pointer to a slice, in insertion order.
+func (s *Store) Find(col string, filter, projection acmogo.Map, results interface{}) error {
+	f, err := toDoc(filter)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	slice := reflect.ValueOf(results)
+	if slice.Kind() != reflect.Ptr || slice.Elem().Kind() != reflect.Slice {
+		return errors.New("memstore: results argument must be a slice address")
+	}
+	slice = slice.Elem()
+	slice.SetLen(0)
+	for _, doc := range s.cols[col] {
+		matched, err := match(doc, f)
+		if err != nil {
+			return err
+		}
+		if !matched {
+			continue
+		}
+		elem := reflect.New(slice.Type().Elem())
+		if err := fromDoc(project(doc, projection), elem.Interface()); err != nil {
+			return err
+		}
+		slice.Set(reflect.Append(slice, elem.Elem()))
+	}
+	return nil
+}
+
+// find returns the index of the first document in col matching filter, or -1.
+func (s *Store) find(col string, filter bson.M) (int, error) {
+	for i, doc := range s.cols[col] {
+		matched, err := match(doc, filter)
+		if err != nil || matched {
+			return i, err
+		}
+	}
+	return -1, nil
+}
+
+var errNotDocument = errors.New("memstore: value does not marshal to a document")
+
+// toDoc converts v to the form mgo unmarshals documents into, so that
+// documents and query values compare the same way whatever Go types built them.
+func toDoc(v interface{}) (bson.M, error) {
+	if v == nil {
+		return bson.M{}, nil
+	}
+	buf, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(buf, &doc); err != nil {
+		return nil, errNotDocument
+	}
+	return doc, nil
+}
+
+func fromDoc(doc bson.M, result interface{}) error {
+	buf, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(buf, result)
+}
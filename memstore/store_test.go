@@ -0,0 +1,221 @@
+package memstore_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/crhntr/acmogo"
+	"github.com/crhntr/acmogo/memstore"
+	"github.com/globalsign/mgo"
+)
+
+const (
+	UserCol = "user"
+	PostCol = "post"
+)
+
+type (
+	User struct {
+		acmogo.Entity `bson:",inline"`
+	}
+
+	Post struct {
+		acmogo.Entity `bson:",inline"`
+		N             int `bson:"n"`
+	}
+)
+
+func (this User) Ref() acmogo.Reference {
+	return acmogo.Reference{Col: UserCol, ID: this.ID}
+}
+
+func (this Post) Ref() acmogo.Reference {
+	return acmogo.Reference{Col: PostCol, ID: this.ID}
+}
+
+func TestStore_InsertList(t *testing.T) {
+	p := memstore.New().Persistence()
+	user0 := User{Entity: acmogo.New()}
+	post0 := Post{Entity: acmogo.New()}
+
+	if _, err := p.InsertList(user0, post0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.InsertList(user0); !mgo.IsDup(err) {
+		t.Errorf("expected a duplicate key error but got %v", err)
+	}
+}
+
+func TestStore_UpdateEntity(t *testing.T) {
+	p := memstore.New().Persistence()
+	post0 := Post{Entity: acmogo.New()}
+	post1 := Post{Entity: acmogo.New()}
+	p.InsertList(post0)
+
+	if err := p.UpdateEntity(post0, acmogo.Map{"$set": acmogo.Map{"n": 101}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.UpdateEntity(post0, acmogo.Map{"$inc": acmogo.Map{"n": 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.RefreshEntity(&post0); err != nil {
+		t.Fatal(err)
+	}
+	if post0.N != 102 {
+		t.Errorf("expected n to be 102 but got %d", post0.N)
+	}
+	if err := p.UpdateEntity(post1, acmogo.Map{"$set": acmogo.Map{"n": 1}}); err != acmogo.ErrNotFound {
+		t.Errorf("expected not found but got %v", err)
+	}
+	if err := p.RefreshEntity(&post1); err != acmogo.ErrNotFound {
+		t.Errorf("expected not found but got %v", err)
+	}
+}
+
+func TestStore_PersistPermit(t *testing.T) {
+	p := memstore.New().Persistence()
+	post0 := Post{Entity: acmogo.New()}
+	user0 := User{Entity: acmogo.New()}
+	user1 := User{Entity: acmogo.New()}
+	p.InsertList(post0, user0, user1)
+
+	if p.ReadPermitted(post0, user0, user1) {
+		t.Error("read should not be permitted")
+	}
+
+	p.PersistPermitDelete(post0, user0)
+	if !p.DeletePermitted(post0, user0) || !p.ReadPermitted(post0, user0) {
+		t.Error("delete and read should be permitted")
+	}
+
+	p.PersistPermitRead(post0, user0)
+	if p.UpdatePermitted(post0, user0) || !p.ReadPermitted(post0, user0) {
+		t.Error("permit read should downgrade the deleter to a reader")
+	}
+
+	p.PersistPermitRead(post0, user0, user1)
+	p.RefreshEntity(&post0)
+	if len(post0.Readers) != 2 {
+		t.Errorf("expected two readers but got %v", post0.Readers)
+	}
+
+	p.PersistClearAccessControl(post0, user0)
+	if p.ReadPermitted(post0, user0) || !p.ReadPermitted(post0, user1) {
+		t.Error("clear should only revoke access of user0")
+	}
+
+	p.PersistPermitUntil(post0, acmogo.Update, time.Now().Add(time.Hour), user0)
+	if !p.UpdatePermitted(post0, user0) {
+		t.Error("update should be permitted through a timed grant")
+	}
+	p.PersistDeny(post0, user0)
+	if p.ReadPermitted(post0, user0) {
+		t.Error("read should not be permitted after deny")
+	}
+	p.PersistUndeny(post0, user0)
+	p.PersistClearAccessControl(post0, user0)
+	if p.UpdatePermitted(post0, user0) {
+		t.Error("clear should remove the timed grant")
+	}
+}
+
+func TestStore_FindPermitted(t *testing.T) {
+	p := memstore.New().Persistence()
+	user0 := User{Entity: acmogo.New()}
+	user1 := User{Entity: acmogo.New()}
+
+	post0 := Post{Entity: acmogo.New(), N: 1}
+	post1 := Post{Entity: acmogo.New(), N: 2}
+	post2 := Post{Entity: acmogo.New(), N: 2}
+	post3 := Post{Entity: acmogo.New(), N: 2}
+
+	post0.SetCreator(user0.Ref())
+	post1.PermitUpdate(user0)
+	post2.Public = true
+	post2.Deny(user1)
+	post3.PermitUntil(acmogo.Read, time.Now().Add(-time.Minute), user0)
+	p.InsertList(post0, post1, post2, post3)
+
+	var posts []Post
+	if err := p.FindPermitted(PostCol, acmogo.Read, []acmogo.Referencer{user0}, nil, &posts); err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 3 {
+		t.Errorf("expected 3 readable posts but got %d", len(posts))
+	}
+
+	p.FindPermitted(PostCol, acmogo.Read, []acmogo.Referencer{user0}, acmogo.Map{"n": 2}, &posts)
+	if len(posts) != 2 {
+		t.Errorf("expected 2 readable posts with n=2 but got %d", len(posts))
+	}
+
+	p.FindPermitted(PostCol, acmogo.Update, []acmogo.Referencer{user0}, nil, &posts)
+	if len(posts) != 2 {
+		t.Errorf("expected 2 updatable posts but got %d", len(posts))
+	}
+
+	p.FindPermitted(PostCol, acmogo.Read, []acmogo.Referencer{user1}, nil, &posts)
+	if len(posts) != 0 {
+		t.Errorf("expected the denied user to find nothing but got %d", len(posts))
+	}
+}
+
+func TestStore_PersistTransferOwnership(t *testing.T) {
+	p := memstore.New().Persistence()
+	user0 := User{Entity: acmogo.New()}
+	user1 := User{Entity: acmogo.New()}
+	post0 := Post{Entity: acmogo.New()}
+	post0.SetCreator(user0.Ref())
+	p.InsertList(post0)
+
+	if err := p.PersistTransferOwnership(post0, user1, user0, ""); err != acmogo.ErrNotCreator {
+		t.Errorf("expected not creator but got %v", err)
+	}
+	if err := p.PersistTransferOwnership(post0, user0, user1, acmogo.Read); err != nil {
+		t.Fatal(err)
+	}
+	if !p.DeletePermitted(post0, user1) || p.UpdatePermitted(post0, user0) || !p.ReadPermitted(post0, user0) {
+		t.Error("expected ownership to move and the old creator to be demoted to reader")
+	}
+}
+
+func TestStore_UpdateAll(t *testing.T) {
+	s := memstore.New()
+	post0 := Post{Entity: acmogo.New(), N: 1}
+	post1 := Post{Entity: acmogo.New(), N: 1}
+	post2 := Post{Entity: acmogo.New(), N: 2}
+	s.Persistence().InsertList(post0, post1, post2)
+
+	n, err := s.UpdateAll(PostCol, acmogo.Map{"n": 1}, acmogo.Map{"$set": acmogo.Map{"n": 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 documents to be updated but got %d", n)
+	}
+	var posts []Post
+	s.Find(PostCol, acmogo.Map{"n": acmogo.Map{"$gte": 3}}, nil, &posts)
+	if len(posts) != 2 {
+		t.Errorf("expected 2 posts with n >= 3 but got %d", len(posts))
+	}
+}
+
+func TestStore_UnsupportedOperator(t *testing.T) {
+	s := memstore.New()
+	post0 := Post{Entity: acmogo.New(), N: 1}
+	s.Persistence().InsertList(post0)
+
+	var posts []Post
+	if err := s.Find(PostCol, acmogo.Map{"n": acmogo.Map{"$mod": []int{2, 1}}}, nil, &posts); err == nil {
+		t.Error("expected an unsupported query operator to fail")
+	}
+	if err := s.UpdateId(PostCol, post0.ID, acmogo.Map{"$rename": acmogo.Map{"n": "m"}}); err == nil {
+		t.Error("expected an unsupported update operator to fail")
+	}
+	if _, err := s.RemoveAll(PostCol, acmogo.Map{"$where": "true"}); err == nil {
+		t.Error("expected an unsupported query operator to fail")
+	}
+	if err := s.Find(PostCol, nil, nil, &posts); err != nil || len(posts) != 1 || posts[0].N != 1 {
+		t.Errorf("expected the failed operations not to change the post but got %+v (err: %v)", posts, err)
+	}
+}
@@ -0,0 +1,234 @@
+package memstore
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/globalsign/mgo/bson"
+)
+
+// apply returns a copy of doc with update applied. An update
+// without operators replaces every field but _id.
+func apply(doc bson.M, update bson.M) (bson.M, error) {
+	updated, err := toDoc(doc)
+	if err != nil {
+		return nil, err
+	}
+	if !isOperatorDoc(update) {
+		update["_id"] = doc["_id"]
+		return update, nil
+	}
+	for op, arg := range update {
+		fields, ok := arg.(bson.M)
+		if !ok {
+			return nil, fmt.Errorf("memstore: %s requires a document", op)
+		}
+		for path, value := range fields {
+			if path == "_id" || strings.HasPrefix(path, "_id.") {
+				return nil, fmt.Errorf("memstore: %s can not modify _id", op)
+			}
+			if err := applyOperator(updated, op, path, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return updated, nil
+}
+
+func applyOperator(doc bson.M, op, path string, value interface{}) error {
+	switch op {
+	case "$set":
+		return set(doc, path, value)
+	case "$unset":
+		unset(doc, path)
+		return nil
+	case "$inc":
+		current, _ := get(doc, path)
+		if current == nil {
+			current = 0
+		}
+		x, okx := number(current)
+		y, oky := number(value)
+		if !okx || !oky {
+			return fmt.Errorf("memstore: $inc on non numeric field %s", path)
+		}
+		return set(doc, path, sum(current, value, x+y))
+	case "$push", "$addToSet", "$pull", "$pullAll":
+	default:
+		return fmt.Errorf("memstore: unsupported update operator %s", op)
+	}
+
+	list, err := array(doc, path)
+	if err != nil {
+		return err
+	}
+	switch op {
+	case "$push", "$addToSet":
+		values := []interface{}{value}
+		if each, ok := value.(bson.M); ok {
+			if v, ok := each["$each"]; ok {
+				values, _ = v.([]interface{})
+			}
+		}
+		for _, v := range values {
+			if op == "$addToSet" && anyEqual([]interface{}{list}, v) {
+				continue
+			}
+			list = append(list, v)
+		}
+	case "$pull":
+		list, err = filter(list, func(elem interface{}) (bool, error) {
+			cond, isDoc := value.(bson.M)
+			if !isDoc {
+				return equal(elem, value), nil
+			}
+			if isOperatorDoc(cond) {
+				return matchField([]interface{}{elem}, cond)
+			}
+			sub, ok := elem.(bson.M)
+			if !ok {
+				return false, nil
+			}
+			return match(sub, cond)
+		})
+		if err != nil {
+			return err
+		}
+	case "$pullAll":
+		values, _ := value.([]interface{})
+		list, _ = filter(list, func(elem interface{}) (bool, error) {
+			return anyEqual(values, elem), nil
+		})
+	}
+	if _, exists := get(doc, path); !exists && len(list) == 0 && op != "$push" && op != "$addToSet" {
+		return nil
+	}
+	return set(doc, path, list)
+}
+
+// array returns the array at path, or nil if there is none.
+func array(doc bson.M, path string) ([]interface{}, error) {
+	v, exists := get(doc, path)
+	if !exists || v == nil {
+		return nil, nil
+	}
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("memstore: field %s is not an array", path)
+	}
+	return list, nil
+}
+
+func filter(list []interface{}, remove func(interface{}) (bool, error)) ([]interface{}, error) {
+	kept := make([]interface{}, 0, len(list))
+	for _, elem := range list {
+		removed, err := remove(elem)
+		if err != nil {
+			return nil, err
+		}
+		if !removed {
+			kept = append(kept, elem)
+		}
+	}
+	return kept, nil
+}
+
+func get(doc bson.M, path string) (interface{}, bool) {
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		sub, ok := doc[key].(bson.M)
+		if !ok {
+			return nil, false
+		}
+		doc = sub
+	}
+	v, ok := doc[keys[len(keys)-1]]
+	return v, ok
+}
+
+func set(doc bson.M, path string, value interface{}) error {
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		switch sub := doc[key].(type) {
+		case bson.M:
+			doc = sub
+		case nil:
+			next := bson.M{}
+			doc[key] = next
+			doc = next
+		default:
+			return fmt.Errorf("memstore: can not create field in non document at %s", path)
+		}
+	}
+	doc[keys[len(keys)-1]] = value
+	return nil
+}
+
+func unset(doc bson.M, path string) {
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		sub, ok := doc[key].(bson.M)
+		if !ok {
+			return
+		}
+		doc = sub
+	}
+	delete(doc, keys[len(keys)-1])
+}
+
+// sum keeps integer fields integers as MongoDB does.
+func sum(a, b interface{}, f float64) interface{} {
+	_, af := a.(float64)
+	_, bf := b.(float64)
+	if af || bf {
+		return f
+	}
+	_, a64 := a.(int64)
+	_, b64 := b.(int64)
+	if a64 || b64 || f > 1<<31-1 || f < -1<<31 {
+		return int64(f)
+	}
+	return int(f)
+}
+
+// project returns the fields of doc selected by projection.
+// A nil projection selects every field.
+func project(doc bson.M, projection map[string]interface{}) bson.M {
+	if len(projection) == 0 {
+		return doc
+	}
+	include := false
+	for _, v := range projection {
+		if truthy(v) {
+			include = true
+		}
+	}
+	if !include {
+		projected, _ := toDoc(doc)
+		for path := range projection {
+			unset(projected, path)
+		}
+		return projected
+	}
+	projected := bson.M{"_id": doc["_id"]}
+	if v, ok := projection["_id"]; ok && !truthy(v) {
+		delete(projected, "_id")
+	}
+	for path, v := range projection {
+		if !truthy(v) {
+			continue
+		}
+		if value, exists := get(doc, path); exists {
+			set(projected, path, value)
+		}
+	}
+	return projected
+}
+
+func truthy(v interface{}) bool {
+	if b, ok := v.(bool); ok {
+		return b
+	}
+	n, _ := number(v)
+	return n != 0
+}
@@ -0,0 +1,88 @@
+package acmogo
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/globalsign/mgo/bson"
+)
+
+// IDFunc returns the id of the entity a request is for.
+// It returns false if the request does not name a valid id.
+type IDFunc func(r *http.Request) (bson.ObjectId, bool)
+
+// PrincipalFunc returns the references a request acts as.
+type PrincipalFunc func(r *http.Request) []Referencer
+
+// QueryID returns an IDFunc reading a hex ObjectId from the query parameter key.
+func QueryID(key string) IDFunc {
+	return func(r *http.Request) (bson.ObjectId, bool) {
+		id := r.URL.Query().Get(key)
+		if !bson.IsObjectIdHex(id) {
+			return "", false
+		}
+		return bson.ObjectIdHex(id), true
+	}
+}
+
+// ContextWithPrincipals returns a copy of ctx carrying refs
+// as the principals the request acts as.
+func ContextWithPrincipals(ctx context.Context, refs ...Referencer) context.Context {
+	return context.WithValue(ctx, principalsKey, refs)
+}
+
+// PrincipalsFromContext returns the principals stored by ContextWithPrincipals.
+func PrincipalsFromContext(ctx context.Context) []Referencer {
+	refs, _ := ctx.Value(principalsKey).([]Referencer)
+	return refs
+}
+
+// ContextPrincipals is a PrincipalFunc returning the principals
+// stored in the request context by ContextWithPrincipals.
+func ContextPrincipals(r *http.Request) []Referencer {
+	return PrincipalsFromContext(r.Context())
+}
+
+// EntityFromContext returns the entity RequirePermission loaded.
+func EntityFromContext(ctx context.Context) (Entity, bool) {
+	ent, ok := ctx.Value(entityKey).(Entity)
+	return ent, ok
+}
+
+// RequirePermission returns middleware that only calls the next handler
+// if the principals of the request hold perm on the entity in col named
+// by the request. It responds 404 if the id is missing or the entity does
+// not exist or is in the trash, 403 if perm is not held and 500 if the entity can not be loaded.
+// The next handler can get the loaded SelectEntityDoc fields with EntityFromContext.
+// The entity and its ancestors are loaded with the context of the request.
+func RequirePermission(p Persistence, col string, perm Permission, id IDFunc, principals PrincipalFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			entityID, ok := id(r)
+			if !ok {
+				http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+				return
+			}
+			q := p.WithContext(r.Context())
+			ent, err := q.loadLive(Reference{col, entityID})
+			if err == ErrNotFound {
+				http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			permitted, err := ent.InheritedPermitted(q.Loader(), perm, principals(r)...)
+			if err != nil {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			if !permitted {
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), entityKey, ent)))
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package acmogo_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/crhntr/acmogo"
+	"github.com/crhntr/acmogo/memstore"
+	"github.com/globalsign/mgo/bson"
+)
+
+func TestRequirePermission(t *testing.T) {
+	p := memstore.New().Persistence()
+	user0 := User{Entity: acmogo.New()}
+	user1 := User{Entity: acmogo.New()}
+	post0 := Post{Entity: acmogo.New()}
+	post0.PermitUpdate(user0)
+	post0.PermitRead(user1)
+	p.InsertList(post0)
+
+	var loaded acmogo.Entity
+	handler := acmogo.RequirePermission(p, PostCol, acmogo.Update, acmogo.QueryID("id"), acmogo.ContextPrincipals)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			loaded, _ = acmogo.EntityFromContext(r.Context())
+		}),
+	)
+
+	for _, tt := range []struct {
+		name   string
+		id     string
+		user   acmogo.Referencer
+		status int
+	}{
+		{"permitted", post0.ID.Hex(), user0, http.StatusOK},
+		{"forbidden", post0.ID.Hex(), user1, http.StatusForbidden},
+		{"missing entity", bson.NewObjectId().Hex(), user0, http.StatusNotFound},
+		{"invalid id", "not-an-id", user0, http.StatusNotFound},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/post?id="+tt.id, nil)
+			req = req.WithContext(acmogo.ContextWithPrincipals(req.Context(), tt.user))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Errorf("expected status %d but got %d", tt.status, rec.Code)
+			}
+		})
+	}
+
+	if loaded.ID != post0.ID || !loaded.UpdatePermitted(user0) {
+		t.Errorf("expected the handler to get the loaded entity but got %+v", loaded)
+	}
+}
+
+func TestRequirePermission_Canceled(t *testing.T) {
+	p := memstore.New().Persistence()
+	user0 := User{Entity: acmogo.New()}
+	post0 := Post{Entity: acmogo.New()}
+	post0.PermitUpdate(user0)
+	p.InsertList(post0)
+
+	handler := acmogo.RequirePermission(p, PostCol, acmogo.Update, acmogo.QueryID("id"), acmogo.ContextPrincipals)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("expected the handler not to be called for a canceled request")
+		}),
+	)
+	ctx, cancel := context.WithCancel(acmogo.ContextWithPrincipals(context.Background(), user0))
+	cancel()
+	req := httptest.NewRequest(http.MethodGet, "/post?id="+post0.ID.Hex(), nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("expected the load to fail with the request context but got %d", rec.Code)
+	}
+}
@@ -0,0 +1,218 @@
+// Package mongodriver implements acmogo.Store on top of the official
+// MongoDB driver so services can move off globalsign/mgo while sharing
+// the access control logic.
+package mongodriver
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/crhntr/acmogo"
+	mgobson "github.com/globalsign/mgo/bson"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Registry is the codec registry Store uses for every collection.
+// It stores the globalsign/mgo bson.ObjectId used by acmogo.Entity and
+// acmogo.Reference as a BSON ObjectId, as mgo does, so documents written
+// by either driver can be read by the other. Values decoded into an
+// interface{}, as those of an acmogo.Map, get the types mgo gives them.
+var Registry = newRegistry()
+
+// Store is an acmogo.Store backed by a *mongo.Database.
+type Store struct {
+	db  *mongo.Database
+	ctx context.Context
+}
+
+var (
+	_ acmogo.ContextStore = Store{}
+	_ acmogo.BulkStore    = Store{}
+)
+
+func New(db *mongo.Database) Store {
+	return Store{db: db, ctx: context.Background()}
+}
+
+// WithContext returns a copy of s that runs its operations with ctx.
+func (s Store) WithContext(ctx context.Context) acmogo.Store {
+	s.ctx = ctx
+	return s
+}
+
+func (s Store) c(col string) *mongo.Collection {
+	return s.db.Collection(col, options.Collection().SetRegistry(Registry))
+}
+
+func (s Store) Insert(col string, doc interface{}) error {
+	_, err := s.c(col).InsertOne(s.ctx, doc)
+	if err != nil {
+		return insertError{err}
+	}
+	return nil
+}
+
+// insertError is the error of a failed insert.
+// acmogo.IsDup recognises it if a unique key was already stored.
+type insertError struct {
+	error
+}
+
+func (err insertError) DuplicateKey() bool {
+	return mongo.IsDuplicateKeyError(err.error)
+}
+
+func (err insertError) Unwrap() error {
+	return err.error
+}
+
+// InsertMany reports the write errors of an insert by document, in a
+// form acmogo.IsDup recognises. A write concern error is returned as err
+// since the documents that did not fail may not have been stored durably.
+func (s Store) InsertMany(col string, ordered bool, docs []interface{}) (map[int]error, error) {
+	failed := make(map[int]error)
+	_, err := s.c(col).InsertMany(s.ctx, docs, options.InsertMany().SetOrdered(ordered))
+	bulkErr, ok := err.(mongo.BulkWriteException)
+	if !ok {
+		return failed, err
+	}
+	for _, we := range bulkErr.WriteErrors {
+		failed[we.Index] = insertError{we.WriteError}
+	}
+	if bulkErr.WriteConcernError != nil {
+		return failed, bulkErr.WriteConcernError
+	}
+	if len(failed) == 0 {
+		return failed, err
+	}
+	return failed, nil
+}
+
+func (s Store) FindId(col string, id mgobson.ObjectId, projection acmogo.Map, result interface{}) error {
+	opts := options.FindOne()
+	if projection != nil {
+		opts.SetProjection(projection)
+	}
+	err := s.c(col).FindOne(s.ctx, bson.M{"_id": id}, opts).Decode(result)
+	if err == mongo.ErrNoDocuments {
+		return acmogo.ErrNotFound
+	}
+	return err
+}
+
+func (s Store) UpdateId(col string, id mgobson.ObjectId, update acmogo.Map) error {
+	return s.Update(col, acmogo.Map{"_id": id}, update)
+}
+
+// Update replaces the document matching selector if update has no update
+// operators, as mgo does, and otherwise applies them.
+func (s Store) Update(col string, selector, update acmogo.Map) error {
+	var (
+		res *mongo.UpdateResult
+		err error
+	)
+	if hasOperators(update) {
+		res, err = s.c(col).UpdateOne(s.ctx, selector, update)
+	} else {
+		res, err = s.c(col).ReplaceOne(s.ctx, selector, update)
+	}
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return acmogo.ErrNotFound
+	}
+	return nil
+}
+
+func hasOperators(update acmogo.Map) bool {
+	for key := range update {
+		if strings.HasPrefix(key, "$") {
+			return true
+		}
+	}
+	return false
+}
+
+func (s Store) UpdateAll(col string, selector, update acmogo.Map) (int, error) {
+	res, err := s.c(col).UpdateMany(s.ctx, selector, update)
+	if err != nil {
+		return 0, err
+	}
+	return int(res.ModifiedCount), nil
+}
+
+func (s Store) RemoveAll(col string, selector acmogo.Map) (int, error) {
+	res, err := s.c(col).DeleteMany(s.ctx, selector)
+	if err != nil {
+		return 0, err
+	}
+	return int(res.DeletedCount), nil
+}
+
+func (s Store) Find(col string, filter, projection acmogo.Map, results interface{}) error {
+	if filter == nil {
+		filter = acmogo.Map{}
+	}
+	opts := options.Find()
+	if projection != nil {
+		opts.SetProjection(projection)
+	}
+	cur, err := s.c(col).Find(s.ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	return cur.All(s.ctx, results)
+}
+
+var tObjectId = reflect.TypeOf(mgobson.ObjectId(""))
+
+func newRegistry() *bsoncodec.Registry {
+	reg := bson.NewRegistry()
+	reg.RegisterTypeEncoder(tObjectId, bsoncodec.ValueEncoderFunc(encodeObjectId))
+	reg.RegisterTypeDecoder(tObjectId, bsoncodec.ValueDecoderFunc(decodeObjectId))
+	reg.RegisterTypeMapEntry(bsontype.ObjectID, tObjectId)
+	reg.RegisterTypeMapEntry(bsontype.EmbeddedDocument, reflect.TypeOf(mgobson.M{}))
+	reg.RegisterTypeMapEntry(bsontype.Array, reflect.TypeOf([]interface{}{}))
+	return reg
+}
+
+func encodeObjectId(_ bsoncodec.EncodeContext, vw bsonrw.ValueWriter, val reflect.Value) error {
+	if !val.IsValid() || val.Type() != tObjectId {
+		return bsoncodec.ValueEncoderError{Name: "encodeObjectId", Types: []reflect.Type{tObjectId}, Received: val}
+	}
+	id := val.String()
+	if len(id) != 12 {
+		return fmt.Errorf("ObjectIDs must be exactly 12 bytes long (got %d)", len(id))
+	}
+	var oid primitive.ObjectID
+	copy(oid[:], id)
+	return vw.WriteObjectID(oid)
+}
+
+func decodeObjectId(_ bsoncodec.DecodeContext, vr bsonrw.ValueReader, val reflect.Value) error {
+	if !val.CanSet() || val.Type() != tObjectId {
+		return bsoncodec.ValueDecoderError{Name: "decodeObjectId", Types: []reflect.Type{tObjectId}, Received: val}
+	}
+	switch vr.Type() {
+	case bsontype.ObjectID:
+		oid, err := vr.ReadObjectID()
+		if err != nil {
+			return err
+		}
+		val.SetString(string(oid[:]))
+		return nil
+	case bsontype.Null:
+		val.SetString("")
+		return vr.ReadNull()
+	}
+	return fmt.Errorf("cannot decode %v into a bson.ObjectId", vr.Type())
+}
@@ -0,0 +1,68 @@
+package mongodriver_test
+
+import (
+	"testing"
+
+	"github.com/crhntr/acmogo"
+	"github.com/crhntr/acmogo/mongodriver"
+	mgobson "github.com/globalsign/mgo/bson"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestRegistry(t *testing.T) {
+	ent := acmogo.New()
+	ent.SetCreator(acmogo.Reference{Col: "user", ID: mgobson.NewObjectId()})
+	ent.PermitRead(acmogo.Reference{Col: "team", ID: mgobson.NewObjectId()})
+
+	buf, err := bson.MarshalWithRegistry(mongodriver.Registry, ent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// documents written with the official driver must be readable by mgo
+	var fromDriver acmogo.Entity
+	if err := mgobson.Unmarshal(buf, &fromDriver); err != nil {
+		t.Fatal(err)
+	}
+	if fromDriver.ID != ent.ID || *fromDriver.Creator != *ent.Creator || fromDriver.Readers[0] != ent.Readers[0] {
+		t.Errorf("expected %+v but got %+v", ent, fromDriver)
+	}
+
+	buf, err = mgobson.Marshal(ent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fromMgo acmogo.Entity
+	if err := bson.UnmarshalWithRegistry(mongodriver.Registry, buf, &fromMgo); err != nil {
+		t.Fatal(err)
+	}
+	if fromMgo.ID != ent.ID || *fromMgo.Creator != *ent.Creator || fromMgo.Readers[0] != ent.Readers[0] {
+		t.Errorf("expected %+v but got %+v", ent, fromMgo)
+	}
+
+	if _, err := bson.MarshalWithRegistry(mongodriver.Registry, acmogo.Reference{Col: "user"}); err == nil {
+		t.Error("expected an invalid ObjectId to fail to encode")
+	}
+}
+
+func TestRegistry_Interface(t *testing.T) {
+	team := acmogo.Reference{Col: "team", ID: mgobson.NewObjectId()}
+	buf, err := mgobson.Marshal(mgobson.M{"teams": []mgobson.ObjectId{team.ID}, "owner": team})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// memberships are read into maps, as with mgo
+	var doc mgobson.M
+	if err := bson.UnmarshalWithRegistry(mongodriver.Registry, buf, &doc); err != nil {
+		t.Fatal(err)
+	}
+	teams, ok := doc["teams"].([]interface{})
+	if !ok || len(teams) != 1 || teams[0] != team.ID {
+		t.Errorf("expected an array of ObjectIds but got %#v", doc["teams"])
+	}
+	owner, ok := doc["owner"].(mgobson.M)
+	if !ok || owner["c"] != team.Col || owner["id"] != team.ID {
+		t.Errorf("expected an embedded document but got %#v", doc["owner"])
+	}
+}
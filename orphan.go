@@ -0,0 +1,162 @@
+package acmogo
+
+import (
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+)
+
+// OrphanBatchSize is the number of documents ScanOrphans reads
+// before checking which of the principals they reference exist.
+var OrphanBatchSize = 500
+
+// Orphan is a grant to a principal whose document no longer exists.
+// Via is the part of the AC the grant was found in, as in Decision.
+type Orphan struct {
+	Entity     Reference  `json:"entity"`
+	Principal  Reference  `json:"principal"`
+	Via        string     `json:"via"`
+	Permission Permission `json:"permission,omitempty"`
+}
+
+// ScanOrphans walks the documents of collections and calls fn with every
+// grant, creator or timed grant to a principal that does not exist in its
+// own collection. If remove is true the orphaned grants of a document are
+// removed after fn was called for them. Scanning stops at the first error,
+// including one returned by fn. Denials are not reported.
+func ScanOrphans(db *mgo.Database, remove bool, fn func(Orphan) error, collections ...string) error {
+	s := orphanScan{
+		p:      mgoPersistence(db),
+		exists: make(map[Reference]bool),
+		remove: remove,
+		fn:     fn,
+	}
+	for _, col := range collections {
+		iter := db.C(col).Find(nil).Select(Map{"_id": 1, ACPath: 1}).Batch(OrphanBatchSize).Iter()
+		batch := make([]Entity, 0, OrphanBatchSize)
+		for {
+			var ent Entity
+			more := iter.Next(&ent)
+			if more {
+				batch = append(batch, ent)
+			}
+			if len(batch) == OrphanBatchSize || !more && len(batch) > 0 {
+				if err := s.scan(col, batch); err != nil {
+					iter.Close()
+					return err
+				}
+				batch = batch[:0]
+			}
+			if !more {
+				break
+			}
+		}
+		if err := iter.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type orphanScan struct {
+	p      Persistence
+	exists map[Reference]bool
+	remove bool
+	fn     func(Orphan) error
+}
+
+// scan reports and removes the orphaned grants of a batch of entities in col.
+func (s orphanScan) scan(col string, batch []Entity) error {
+	grants := make([][]Orphan, len(batch))
+	var unknown []Reference
+	for i, ent := range batch {
+		grants[i] = entityGrants(Reference{col, ent.ID}, ent.AC)
+		for _, grant := range grants[i] {
+			if _, ok := s.exists[grant.Principal]; !ok {
+				s.exists[grant.Principal] = false
+				unknown = append(unknown, grant.Principal)
+			}
+		}
+	}
+	if err := s.resolve(unknown); err != nil {
+		return err
+	}
+
+	for _, entityGrants := range grants {
+		var orphans []Orphan
+		for _, grant := range entityGrants {
+			if s.exists[grant.Principal] {
+				continue
+			}
+			if err := s.fn(grant); err != nil {
+				return err
+			}
+			orphans = append(orphans, grant)
+		}
+		if s.remove && len(orphans) > 0 {
+			if err := s.p.updateId(orphans[0].Entity, orphanUpdateDoc(orphans)); err != nil && err != ErrNotFound {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resolve marks the refs whose documents exist, with one $in query per collection.
+func (s orphanScan) resolve(refs []Reference) error {
+	ids := make(map[string][]bson.ObjectId)
+	for _, ref := range refs {
+		ids[ref.Col] = append(ids[ref.Col], ref.ID)
+	}
+	for col, colIDs := range ids {
+		var found []Entity
+		if err := s.p.Store.Find(col, Map{"_id": Map{"$in": colIDs}}, Map{"_id": 1}, &found); err != nil {
+			return err
+		}
+		for _, ent := range found {
+			s.exists[Reference{col, ent.ID}] = true
+		}
+	}
+	return nil
+}
+
+// entityGrants lists every principal ac grants something to as an Orphan candidate.
+func entityGrants(entity Reference, ac AC) []Orphan {
+	var grants []Orphan
+	if ac.Creator != nil {
+		grants = append(grants, Orphan{Entity: entity, Principal: *ac.Creator, Via: ViaCreator})
+	}
+	for _, perm := range Permissions() {
+		for _, ref := range ac.References(perm) {
+			grants = append(grants, Orphan{Entity: entity, Principal: ref, Via: perm.via(), Permission: perm})
+		}
+	}
+	for _, grant := range ac.Timed {
+		grants = append(grants, Orphan{Entity: entity, Principal: grant.Ref, Via: ViaTimed, Permission: grant.Permission})
+	}
+	return grants
+}
+
+func orphanUpdateDoc(orphans []Orphan) Map {
+	pullAll := Map{}
+	var timed []Reference
+	update := Map{}
+	for _, orphan := range orphans {
+		switch orphan.Via {
+		case ViaCreator:
+			update["$unset"] = Map{CreatorPath: ""}
+		case ViaTimed:
+			timed = append(timed, orphan.Principal)
+		default:
+			path := orphan.Permission.Path()
+			refs, _ := pullAll[path].([]Reference)
+			pullAll[path] = append(refs, orphan.Principal)
+		}
+	}
+	if len(pullAll) > 0 {
+		update["$pullAll"] = pullAll
+	}
+	if len(timed) > 0 {
+		update["$pull"] = Map{TimedPath: Map{"ref": Map{"$in": timed}}}
+	}
+	return update
+}
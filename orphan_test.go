@@ -0,0 +1,60 @@
+package acmogo_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/crhntr/acmogo"
+)
+
+func TestScanOrphans(t *testing.T) {
+	requireDB(t)
+	dropCollections(PostCol, UserCol, TeamCol)
+	defer dropCollections(PostCol, UserCol, TeamCol)
+
+	user0 := User{Entity: acmogo.New()}
+	gone0 := User{Entity: acmogo.New()}
+	gone1 := Team{Entity: acmogo.New()}
+	post0 := Post{Entity: acmogo.New()}
+	post1 := Post{Entity: acmogo.New()}
+
+	post0.SetCreator(gone0.Ref())
+	post0.PermitRead(user0, gone1)
+	post1.PermitUpdate(user0)
+	post1.PermitUntil(acmogo.Read, time.Now().Add(time.Hour), gone1)
+	acmogo.InsertList(db, user0, post0, post1)
+
+	var orphans []acmogo.Orphan
+	collect := func(o acmogo.Orphan) error {
+		orphans = append(orphans, o)
+		return nil
+	}
+	if err := acmogo.ScanOrphans(db, false, collect, PostCol); err != nil {
+		t.Fatal(err)
+	}
+	if len(orphans) != 3 {
+		t.Fatalf("expected 3 orphaned grants but got %+v", orphans)
+	}
+	vias := map[string]bool{}
+	for _, o := range orphans {
+		vias[o.Via] = true
+		if o.Principal == user0.Ref() {
+			t.Errorf("expected existing principals not to be reported but got %+v", o)
+		}
+	}
+	if !vias[acmogo.ViaCreator] || !vias[acmogo.ViaReaders] || !vias[acmogo.ViaTimed] {
+		t.Errorf("unexpected orphans %+v", orphans)
+	}
+
+	if err := acmogo.ScanOrphans(db, true, func(acmogo.Orphan) error { return nil }, PostCol); err != nil {
+		t.Fatal(err)
+	}
+	orphans = nil
+	acmogo.ScanOrphans(db, false, collect, PostCol)
+	if len(orphans) != 0 {
+		t.Errorf("expected the orphaned grants to be removed but got %+v", orphans)
+	}
+	if !acmogo.ReadPermitted(db, post0, user0) || !acmogo.UpdatePermitted(db, post1, user0) {
+		t.Error("expected grants to existing principals to be kept")
+	}
+}
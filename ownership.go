@@ -0,0 +1,77 @@
+package acmogo
+
+import (
+	"errors"
+
+	"github.com/globalsign/mgo"
+)
+
+var ErrNotCreator = errors.New("reference is not the creator")
+
+// TransferOwnership replaces the creator with to if from is the current creator.
+func (ac *AC) TransferOwnership(from, to Reference) error {
+	if ac.Creator == nil || ac.Creator.Col != from.Col || ac.Creator.ID != from.ID {
+		return ErrNotCreator
+	}
+	if err := to.Validate(); err != nil {
+		return err
+	}
+	ac.Creator = &to
+	return nil
+}
+
+// PersistTransferOwnership replaces the creator of the stored entity with to
+// if, and only if, from is the current creator. When demote is not empty
+// from is granted demote in the same update.
+// It returns ErrNotCreator if the entity exists but from is not its creator.
+func PersistTransferOwnership(db *mgo.Database, entity Referencer, from, to Referencer, demote Permission) error {
+	return mgoPersistence(db).PersistTransferOwnership(entity, from, to, demote)
+}
+
+func (p Persistence) PersistTransferOwnership(entity Referencer, from, to Referencer, demote Permission) error {
+	ref := entity.Ref()
+	update, err := transferUpdateDoc(from.Ref(), to.Ref(), demote)
+	if err != nil {
+		return err
+	}
+	err = p.update(ref, Map{"_id": ref.ID, CreatorPath: from.Ref()}, update)
+	return p.selectorErr(ref, err, ErrNotCreator)
+}
+
+// PersistTransferAllOwnership replaces the creator of every document
+// in cols created by from with to. It returns the number of documents
+// updated in each collection.
+func PersistTransferAllOwnership(db *mgo.Database, from, to Referencer, demote Permission, cols ...string) (map[string]int, error) {
+	return mgoPersistence(db).PersistTransferAllOwnership(from, to, demote, cols...)
+}
+
+func (p Persistence) PersistTransferAllOwnership(from, to Referencer, demote Permission, cols ...string) (map[string]int, error) {
+	update, err := transferUpdateDoc(from.Ref(), to.Ref(), demote)
+	if err != nil {
+		return nil, err
+	}
+	updated := make(map[string]int, len(cols))
+	for _, col := range cols {
+		n, err := p.updateAll(col, Map{CreatorPath: from.Ref()}, update)
+		if err != nil {
+			return updated, err
+		}
+		updated[col] = n
+	}
+	return updated, nil
+}
+
+func transferUpdateDoc(from, to Reference, demote Permission) (Map, error) {
+	if err := to.Validate(); err != nil {
+		return nil, err
+	}
+	update := Map{}
+	if demote != "" {
+		if !demote.Registered() {
+			return nil, ErrUnknownPermission
+		}
+		update = permitUpdateDoc(demote, []Reference{from})
+	}
+	update["$set"] = Map{CreatorPath: to}
+	return update, nil
+}
@@ -0,0 +1,86 @@
+package acmogo_test
+
+import (
+	"testing"
+
+	"github.com/crhntr/acmogo"
+)
+
+func TestAC_TransferOwnership(t *testing.T) {
+	user0 := User{Entity: acmogo.New()}
+	user1 := User{Entity: acmogo.New()}
+	post0 := Post{Entity: acmogo.New()}
+
+	if err := post0.TransferOwnership(user0.Ref(), user1.Ref()); err != acmogo.ErrNotCreator {
+		t.Errorf("expected not creator error but got %v", err)
+	}
+	post0.SetCreator(user0.Ref())
+	if err := post0.TransferOwnership(user1.Ref(), user0.Ref()); err != acmogo.ErrNotCreator {
+		t.Errorf("expected not creator error but got %v", err)
+	}
+	if err := post0.TransferOwnership(user0.Ref(), acmogo.Reference{}); err == nil {
+		t.Error("expected an invalid reference to be rejected")
+	}
+	if err := post0.TransferOwnership(user0.Ref(), user1.Ref()); err != nil {
+		t.Fatal(err)
+	}
+	if !post0.DeletePermitted(user1) || post0.ReadPermitted(user0) {
+		t.Error("expected ownership to move to user1")
+	}
+}
+
+func TestPersistTransferOwnership(t *testing.T) {
+	requireDB(t)
+
+	user0 := User{Entity: acmogo.New()}
+	user1 := User{Entity: acmogo.New()}
+	post0 := Post{Entity: acmogo.New()}
+	post1 := Post{Entity: acmogo.New()}
+
+	post0.SetCreator(user0.Ref())
+	acmogo.InsertList(db, post0)
+
+	if err := acmogo.PersistTransferOwnership(db, post0, user1, user0, ""); err != acmogo.ErrNotCreator {
+		t.Errorf("expected not creator error but got %v", err)
+	}
+	if err := acmogo.PersistTransferOwnership(db, post1, user0, user1, ""); err != acmogo.ErrNotFound {
+		t.Errorf("expected not found error but got %v", err)
+	}
+	if err := acmogo.PersistTransferOwnership(db, post0, user0, user1, acmogo.Update); err != nil {
+		t.Fatal(err)
+	}
+	if !acmogo.DeletePermitted(db, post0, user1) {
+		t.Error("delete should be permitted for the new creator")
+	}
+	if !acmogo.UpdatePermitted(db, post0, user0) || acmogo.DeletePermitted(db, post0, user0) {
+		t.Error("the old creator should be demoted to updater")
+	}
+}
+
+func TestPersistTransferAllOwnership(t *testing.T) {
+	requireDB(t)
+
+	user0 := User{Entity: acmogo.New()}
+	user1 := User{Entity: acmogo.New()}
+	post0 := Post{Entity: acmogo.New()}
+	post1 := Post{Entity: acmogo.New()}
+	team0 := Team{Entity: acmogo.New()}
+
+	for _, ac := range []*acmogo.AC{&post0.AC, &post1.AC, &team0.AC} {
+		ac.SetCreator(user0.Ref())
+	}
+	acmogo.InsertList(db, post0, post1, team0)
+
+	updated, err := acmogo.PersistTransferAllOwnership(db, user0, user1, "", PostCol, TeamCol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated[PostCol] != 2 || updated[TeamCol] != 1 {
+		t.Errorf("unexpected update counts %v", updated)
+	}
+	for _, ent := range []acmogo.Referencer{post0, post1, team0} {
+		if acmogo.ReadPermitted(db, ent, user0) || !acmogo.DeletePermitted(db, ent, user1) {
+			t.Errorf("expected ownership of %v to move to user1", ent.Ref())
+		}
+	}
+}
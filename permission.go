@@ -0,0 +1,144 @@
+package acmogo
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Permission names an access level that can be granted to a Reference.
+// Read, Update and Delete are built in; others are added with RegisterPermission.
+type Permission string
+
+const (
+	Read   Permission = "read"
+	Update Permission = "update"
+	Delete Permission = "delete"
+)
+
+var (
+	ErrUnknownPermission = errors.New("unknown permission")
+	ErrInvalidPermission = errors.New("invalid permission name")
+)
+
+var registry = struct {
+	sync.RWMutex
+	implies map[Permission][]Permission
+	order   []Permission
+}{
+	implies: map[Permission][]Permission{
+		Read:   nil,
+		Update: {Read},
+		Delete: {Update},
+	},
+	order: []Permission{Read, Update, Delete},
+}
+
+// RegisterPermission adds perm to the registry. A reference granted perm is
+// also granted every permission in implies and everything those imply.
+// Implied permissions must already be registered, so the hierarchy can not
+// contain cycles.
+//
+//	acmogo.RegisterPermission("comment", acmogo.Read)
+//	acmogo.RegisterPermission("admin", acmogo.Delete, "comment")
+func RegisterPermission(perm Permission, implies ...Permission) error {
+	if perm == "" || strings.ContainsAny(string(perm), ".$") {
+		return ErrInvalidPermission
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	if _, exists := registry.implies[perm]; exists {
+		return errors.New("permission already registered")
+	}
+	for _, implied := range implies {
+		if _, exists := registry.implies[implied]; !exists {
+			return ErrUnknownPermission
+		}
+	}
+	registry.implies[perm] = append([]Permission(nil), implies...)
+	registry.order = append(registry.order, perm)
+	return nil
+}
+
+// Permissions returns every registered permission in registration order.
+func Permissions() []Permission {
+	registry.RLock()
+	defer registry.RUnlock()
+	return append([]Permission(nil), registry.order...)
+}
+
+// Registered reports whether perm has been registered.
+func (perm Permission) Registered() bool {
+	registry.RLock()
+	defer registry.RUnlock()
+	_, exists := registry.implies[perm]
+	return exists
+}
+
+// Implies reports whether a reference granted perm also holds other.
+// Every permission implies itself.
+func (perm Permission) Implies(other Permission) bool {
+	registry.RLock()
+	defer registry.RUnlock()
+	return implies(perm, other)
+}
+
+func implies(perm, other Permission) bool {
+	if perm == other {
+		return true
+	}
+	for _, implied := range registry.implies[perm] {
+		if implies(implied, other) {
+			return true
+		}
+	}
+	return false
+}
+
+// Path returns the field path the persisted AC uses to store
+// the references granted perm.
+func (perm Permission) Path() string {
+	switch perm {
+	case Read:
+		return ReadersPath
+	case Update:
+		return UpdatersPath
+	case Delete:
+		return DeletersPath
+	}
+	return GrantsPath + "." + string(perm)
+}
+
+// granting returns every registered permission that implies perm, the
+// most powerful first: a permission comes before every permission it
+// implies and longer chains of implied permissions come first.
+// It returns nil if perm is not registered.
+func (perm Permission) granting() []Permission {
+	registry.RLock()
+	defer registry.RUnlock()
+	if _, exists := registry.implies[perm]; !exists {
+		return nil
+	}
+	var perms []Permission
+	for _, p := range registry.order {
+		if implies(p, perm) {
+			perms = append(perms, p)
+		}
+	}
+	sort.SliceStable(perms, func(i, j int) bool {
+		return depth(perms[i]) > depth(perms[j])
+	})
+	return perms
+}
+
+// depth returns the length of the longest chain of permissions perm implies.
+func depth(perm Permission) int {
+	d := 0
+	for _, implied := range registry.implies[perm] {
+		if n := depth(implied) + 1; n > d {
+			d = n
+		}
+	}
+	return d
+}
@@ -2,116 +2,199 @@ package acmogo
 
 import "github.com/globalsign/mgo"
 
+// InsertList stores entities one by one as they are, without applying
+// the policies registered for their collections; see InsertAs.
 func InsertList(db *mgo.Database, entityList ...Referencer) (int, error) {
+	return mgoPersistence(db).InsertList(entityList...)
+}
+
+func (p Persistence) InsertList(entityList ...Referencer) (int, error) {
 	for i, entity := range entityList {
 		ref := entity.Ref()
-		if err := db.C(ref.Col).Insert(entity); err != nil {
+		if p.Cache != nil {
+			p.Cache.Invalidate(ref)
+		}
+		if err := p.Store.Insert(ref.Col, entity); err != nil {
 			return len(entityList) - i, err
 		}
 	}
 	return len(entityList), nil
 }
 
+// RefreshEntity loads the whole stored document of entity into it, whether
+// or not it is in the trash. Use Trashed to tell, as permission checks do.
 func RefreshEntity(db *mgo.Database, entity Referencer) error {
+	return mgoPersistence(db).RefreshEntity(entity)
+}
+
+func (p Persistence) RefreshEntity(entity Referencer) error {
 	ref := entity.Ref()
-	return db.C(ref.Col).FindId(ref.ID).One(entity)
+	return p.Store.FindId(ref.Col, ref.ID, nil, entity)
 }
 
+// UpdateEntity applies updateDoc to the stored entity, incrementing its
+// Version and setting UpdatedAt in the same update. A replacement document
+// only replaces the version it was stamped for, so ErrConflict is returned
+// if the entity was updated in between.
 func UpdateEntity(db *mgo.Database, entity Referencer, updateDoc Map) error {
+	return mgoPersistence(db).UpdateEntity(entity, updateDoc)
+}
+
+func (p Persistence) UpdateEntity(entity Referencer, updateDoc Map) error {
 	ref := entity.Ref()
-	return db.C(ref.Col).UpdateId(ref.ID, updateDoc)
+	return p.updateStamped(ref, nil, updateDoc)
 }
 
 func ReadPermitted(db *mgo.Database, entity Referencer, refs ...Referencer) bool {
-	var (
-		ent Entity
-		ref = entity.Ref()
-	)
-	if err := db.C(ref.Col).FindId(ref.ID).Select(SelectEntityDoc).One(&ent); err != nil {
-		return false
-	}
-	return ent.AC.ReadPermitted(refs...)
+	return mgoPersistence(db).Permitted(entity, Read, refs...)
 }
 
 func UpdatePermitted(db *mgo.Database, entity Referencer, refs ...Referencer) bool {
-	var (
-		ent Entity
-		ref = entity.Ref()
-	)
-	if err := db.C(ref.Col).FindId(ref.ID).Select(SelectEntityDoc).One(&ent); err != nil {
-		return false
-	}
-	return ent.AC.UpdatePermitted(refs...)
+	return mgoPersistence(db).Permitted(entity, Update, refs...)
 }
 
 func DeletePermitted(db *mgo.Database, entity Referencer, refs ...Referencer) bool {
-	var (
-		ent Entity
-		ref = entity.Ref()
-	)
-	if err := db.C(ref.Col).FindId(ref.ID).Select(SelectEntityDoc).One(&ent); err != nil {
+	return mgoPersistence(db).Permitted(entity, Delete, refs...)
+}
+
+func (p Persistence) ReadPermitted(entity Referencer, refs ...Referencer) bool {
+	return p.Permitted(entity, Read, refs...)
+}
+
+func (p Persistence) UpdatePermitted(entity Referencer, refs ...Referencer) bool {
+	return p.Permitted(entity, Update, refs...)
+}
+
+func (p Persistence) DeletePermitted(entity Referencer, refs ...Referencer) bool {
+	return p.Permitted(entity, Delete, refs...)
+}
+
+// Permitted loads the stored AC of entity, merged with those it inherits,
+// and reports whether any of refs holds perm.
+func Permitted(db *mgo.Database, entity Referencer, perm Permission, refs ...Referencer) bool {
+	return mgoPersistence(db).Permitted(entity, perm, refs...)
+}
+
+func (p Persistence) Permitted(entity Referencer, perm Permission, refs ...Referencer) bool {
+	ent, err := p.loadLive(entity.Ref())
+	if err != nil {
 		return false
 	}
-	return ent.AC.DeletePermitted(refs...)
+	permitted, err := ent.InheritedPermitted(p.Loader(), perm, refs...)
+	return err == nil && permitted
 }
 
 func PersistClearAccessControl(db *mgo.Database, entity Referencer, entities ...Referencer) error {
+	return mgoPersistence(db).PersistClearAccessControl(entity, entities...)
+}
+
+func (p Persistence) PersistClearAccessControl(entity Referencer, entities ...Referencer) error {
 	ref := entity.Ref()
-	var refs []Reference
-	for _, ent := range entities {
-		refs = append(refs, ent.Ref())
+	refs := refList(entities)
+	pullAll := Map{}
+	for _, perm := range Permissions() {
+		pullAll[perm.Path()] = refs
 	}
-	return db.C(ref.Col).UpdateId(ref.ID, Map{
-		"$pullAll": Map{ACPath + ".u": refs, ACPath + ".d": refs, ACPath + ".r": refs},
+	return p.updateId(ref, Map{
+		"$pullAll": pullAll,
+		"$pull":    Map{TimedPath: Map{"ref": Map{"$in": refs}}},
 	})
 }
 
 func PersistPermitRead(db *mgo.Database, entity Referencer, entities ...Referencer) error {
-	ref := entity.Ref()
-	var refs []Reference
-	for _, ent := range entities {
-		refs = append(refs, ent.Ref())
-	}
-	return db.C(ref.Col).UpdateId(ref.ID, Map{
-		"$pullAll":  Map{ACPath + ".u": refs, ACPath + ".d": refs},
-		"$addToSet": Map{ACPath + ".r": Map{"$each": refs}},
-	})
+	return mgoPersistence(db).PersistPermit(entity, Read, entities...)
 }
 
 func PersistPermitUpdate(db *mgo.Database, entity Referencer, entities ...Referencer) error {
+	return mgoPersistence(db).PersistPermit(entity, Update, entities...)
+}
+
+func PersistPermitDelete(db *mgo.Database, entity Referencer, entities ...Referencer) error {
+	return mgoPersistence(db).PersistPermit(entity, Delete, entities...)
+}
+
+func (p Persistence) PersistPermitRead(entity Referencer, entities ...Referencer) error {
+	return p.PersistPermit(entity, Read, entities...)
+}
+
+func (p Persistence) PersistPermitUpdate(entity Referencer, entities ...Referencer) error {
+	return p.PersistPermit(entity, Update, entities...)
+}
+
+func (p Persistence) PersistPermitDelete(entity Referencer, entities ...Referencer) error {
+	return p.PersistPermit(entity, Delete, entities...)
+}
+
+// PersistPermit grants perm to entities on the stored entity
+// replacing any permission they held before.
+func PersistPermit(db *mgo.Database, entity Referencer, perm Permission, entities ...Referencer) error {
+	return mgoPersistence(db).PersistPermit(entity, perm, entities...)
+}
+
+func (p Persistence) PersistPermit(entity Referencer, perm Permission, entities ...Referencer) error {
+	if !perm.Registered() {
+		return ErrUnknownPermission
+	}
 	ref := entity.Ref()
-	var refs []Reference
-	for _, ent := range entities {
-		refs = append(refs, ent.Ref())
+	return p.updateId(ref, permitUpdateDoc(perm, refList(entities)))
+}
+
+func permitUpdateDoc(perm Permission, refs []Reference) Map {
+	pullAll := Map{}
+	for _, p := range Permissions() {
+		if p != perm {
+			pullAll[p.Path()] = refs
+		}
 	}
-	return db.C(ref.Col).UpdateId(ref.ID, Map{
-		"$pullAll":  Map{ACPath + ".r": refs, ACPath + ".d": refs},
-		"$addToSet": Map{ACPath + ".u": Map{"$each": refs}},
+	return Map{
+		"$pullAll":  pullAll,
+		"$pull":     Map{TimedPath: Map{"ref": Map{"$in": refs}}},
+		"$addToSet": Map{perm.Path(): Map{"$each": refs}},
+	}
+}
+
+// PersistDeny blocks entities from every permission on the stored entity.
+func PersistDeny(db *mgo.Database, entity Referencer, entities ...Referencer) error {
+	return mgoPersistence(db).PersistDeny(entity, entities...)
+}
+
+func (p Persistence) PersistDeny(entity Referencer, entities ...Referencer) error {
+	ref := entity.Ref()
+	return p.updateId(ref, Map{
+		"$addToSet": Map{DeniedPath: Map{"$each": refList(entities)}},
 	})
 }
 
-func PersistPermitDelete(db *mgo.Database, entity Referencer, entities ...Referencer) error {
+// PersistUndeny lifts a previous PersistDeny.
+func PersistUndeny(db *mgo.Database, entity Referencer, entities ...Referencer) error {
+	return mgoPersistence(db).PersistUndeny(entity, entities...)
+}
+
+func (p Persistence) PersistUndeny(entity Referencer, entities ...Referencer) error {
 	ref := entity.Ref()
-	var refs []Reference
-	for _, ent := range entities {
-		refs = append(refs, ent.Ref())
-	}
-	return db.C(ref.Col).UpdateId(ref.ID, Map{
-		"$pullAll":  Map{ACPath + ".r": refs, ACPath + ".u": refs},
-		"$addToSet": Map{ACPath + ".d": Map{"$each": refs}},
+	return p.updateId(ref, Map{
+		"$pullAll": Map{DeniedPath: refList(entities)},
 	})
 }
 
 func PersistPublic(db *mgo.Database, entity Referencer) error {
+	return mgoPersistence(db).PersistPublic(entity)
+}
+
+func (p Persistence) PersistPublic(entity Referencer) error {
 	ref := entity.Ref()
-	return db.C(ref.Col).UpdateId(ref.ID, Map{
-		"$set": Map{ACPath + ".p": true},
+	return p.updateId(ref, Map{
+		"$set": Map{PublicPath: true},
 	})
 }
 
 func PersistPrivate(db *mgo.Database, entity Referencer) error {
+	return mgoPersistence(db).PersistPrivate(entity)
+}
+
+func (p Persistence) PersistPrivate(entity Referencer) error {
 	ref := entity.Ref()
-	return db.C(ref.Col).UpdateId(ref.ID, Map{
-		"$set": Map{ACPath + ".p": false},
+	return p.updateId(ref, Map{
+		"$set": Map{PublicPath: false},
 	})
 }
@@ -0,0 +1,144 @@
+package acmogo
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/globalsign/mgo"
+)
+
+var (
+	// ErrPublic is returned by NotPublic.
+	ErrPublic = errors.New("entity must not be public")
+
+	// ErrCreator is the error of the PolicyError InsertAs returns
+	// for an entity whose creator is not the actor.
+	ErrCreator = errors.New("entity must be created by the actor")
+)
+
+// Controlled is an entity whose AC can be changed before it is inserted.
+// Pointers to structs embedding Entity implement it.
+type Controlled interface {
+	Referencer
+	AccessControl() *AC
+}
+
+// AccessControl returns the AC of ent.
+func (ent *Entity) AccessControl() *AC {
+	return &ent.AC
+}
+
+// Policy prepares and checks the AC of the entities InsertAs inserts into a collection.
+// It is only applied by InsertAs; InsertList, BulkInsert, BulkInsertOrdered
+// and the Persist functions store ACs as they are given.
+type Policy struct {
+	// Default, if set, is applied to the AC of every entity
+	// after its creator has been set.
+	Default func(ac *AC, creator Reference) error
+
+	// Validate, if set, rejects entities whose AC is not allowed.
+	Validate func(ac AC) error
+}
+
+// PolicyError is returned by InsertAs when an entity violates the policy of its collection.
+type PolicyError struct {
+	Ref Reference
+	Err error
+}
+
+func (err *PolicyError) Error() string {
+	return fmt.Sprintf("%s %s violates access control policy: %s", err.Ref.Col, err.Ref.ID.Hex(), err.Err)
+}
+
+var policies = struct {
+	sync.RWMutex
+	byCol map[string]Policy
+}{byCol: make(map[string]Policy)}
+
+// RegisterPolicy sets the policy InsertAs applies to entities inserted into col,
+// replacing any policy registered for col before.
+//
+//	acmogo.RegisterPolicy("invoice", acmogo.Policy{Validate: acmogo.NotPublic})
+func RegisterPolicy(col string, policy Policy) {
+	policies.Lock()
+	defer policies.Unlock()
+	policies.byCol[col] = policy
+}
+
+// UnregisterPolicy removes the policy registered for col, if any.
+func UnregisterPolicy(col string) {
+	policies.Lock()
+	defer policies.Unlock()
+	delete(policies.byCol, col)
+}
+
+// PolicyFor returns the policy registered for col.
+func PolicyFor(col string) (Policy, bool) {
+	policies.RLock()
+	defer policies.RUnlock()
+	policy, ok := policies.byCol[col]
+	return policy, ok
+}
+
+// NotPublic is a Policy Validate function rejecting public entities.
+func NotPublic(ac AC) error {
+	if ac.Public {
+		return ErrPublic
+	}
+	return nil
+}
+
+// InsertAs stores entities created by actor with BulkInsertOrdered. The
+// creator of entities without one is set to actor and the policy of their
+// collection is applied, with actor, to their AC. An entity whose creator
+// is already set to another principal is rejected with ErrCreator.
+// If the AC of any entity violates its policy, a *PolicyError is returned
+// and neither is anything inserted nor is any entity changed.
+func InsertAs(db *mgo.Database, actor Referencer, entities ...Controlled) (BulkInsertResult, error) {
+	return mgoPersistence(db).InsertAs(actor, entities...)
+}
+
+func (p Persistence) InsertAs(actor Referencer, entities ...Controlled) (BulkInsertResult, error) {
+	creator := actor.Ref()
+	if err := creator.Validate(); err != nil {
+		return BulkInsertResult{}, err
+	}
+	acs := make([]AC, len(entities))
+	for i, entity := range entities {
+		ac := entity.AccessControl().clone()
+		if ac.Creator != nil && *ac.Creator != creator {
+			return BulkInsertResult{}, &PolicyError{Ref: entity.Ref(), Err: ErrCreator}
+		}
+		ac.Creator = nil
+		ac.SetCreator(creator)
+		if err := applyPolicy(entity.Ref(), &ac, creator); err != nil {
+			return BulkInsertResult{}, err
+		}
+		acs[i] = ac
+	}
+	list := make([]Referencer, len(entities))
+	for i, entity := range entities {
+		*entity.AccessControl() = acs[i]
+		list[i] = entity
+	}
+	return p.BulkInsertOrdered(list...)
+}
+
+func applyPolicy(ref Reference, ac *AC, creator Reference) error {
+	policy, ok := PolicyFor(ref.Col)
+	if !ok {
+		return nil
+	}
+	if policy.Default != nil {
+		if err := policy.Default(ac, creator); err != nil {
+			return &PolicyError{Ref: ref, Err: err}
+		}
+	}
+	if policy.Validate != nil {
+		if err := policy.Validate(*ac); err != nil {
+			return &PolicyError{Ref: ref, Err: err}
+		}
+	}
+	return nil
+}
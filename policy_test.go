@@ -0,0 +1,77 @@
+package acmogo_test
+
+import (
+	"testing"
+
+	"github.com/crhntr/acmogo"
+	"github.com/crhntr/acmogo/memstore"
+)
+
+func TestInsertAs(t *testing.T) {
+	team0 := Team{Entity: acmogo.New()}
+	user0 := User{Entity: acmogo.New()}
+	user0.Teams = append(user0.Teams, team0.ID)
+	teams := map[acmogo.Reference][]acmogo.Referencer{user0.Ref(): {team0}}
+
+	// posts start readable by the creator's teams and are never public
+	acmogo.RegisterPolicy(PostCol, acmogo.Policy{
+		Default: func(ac *acmogo.AC, creator acmogo.Reference) error {
+			ac.PermitRead(teams[creator]...)
+			return nil
+		},
+		Validate: acmogo.NotPublic,
+	})
+	defer acmogo.UnregisterPolicy(PostCol)
+
+	p := memstore.New().Persistence()
+	post0 := Post{Entity: acmogo.New()}
+	if result, err := p.InsertAs(user0, &post0); err != nil || len(result.Inserted) != 1 {
+		t.Fatalf("expected post0 to be inserted but got %+v (err: %v)", result, err)
+	}
+	if !p.DeletePermitted(post0, user0) {
+		t.Error("expected the actor to be stamped as the creator")
+	}
+	if !p.ReadPermitted(post0, team0) {
+		t.Error("expected the default policy to be applied")
+	}
+
+	post1 := Post{Entity: acmogo.New()}
+	post2 := Post{Entity: acmogo.New()}
+	post2.Public = true
+	_, err := p.InsertAs(user0, &post1, &post2)
+	if perr, ok := err.(*acmogo.PolicyError); !ok || perr.Ref != post2.Ref() || perr.Err != acmogo.ErrPublic {
+		t.Errorf("expected the public post to violate the policy but got %v", err)
+	}
+	if err := p.RefreshEntity(&post1); err != acmogo.ErrNotFound {
+		t.Errorf("expected nothing to be inserted but got %v", err)
+	}
+	if post1.Creator != nil || len(post1.Readers) != 0 {
+		t.Errorf("expected a rejected entity to be left unchanged but got %+v", post1.AC)
+	}
+
+	// entities can not be inserted on behalf of another principal
+	post3 := Post{Entity: acmogo.New()}
+	post3.SetCreator(team0.Ref())
+	_, err = p.InsertAs(user0, &post3)
+	if perr, ok := err.(*acmogo.PolicyError); !ok || perr.Ref != post3.Ref() || perr.Err != acmogo.ErrCreator {
+		t.Errorf("expected a forged creator to be rejected but got %v", err)
+	}
+	if err := p.RefreshEntity(&post3); err != acmogo.ErrNotFound {
+		t.Errorf("expected the post not to be inserted but got %v", err)
+	}
+	post4 := Post{Entity: acmogo.New()}
+	post4.SetCreator(user0.Ref())
+	if _, err := p.InsertAs(user0, &post4); err != nil || !p.ReadPermitted(post4, team0) {
+		t.Errorf("expected a post already created by the actor to be inserted (err: %v)", err)
+	}
+
+	team1 := Team{Entity: acmogo.New()}
+	if _, err := p.InsertAs(acmogo.Reference{}, &team1); err == nil {
+		t.Error("expected an invalid actor to be rejected")
+	}
+
+	acmogo.UnregisterPolicy(PostCol)
+	if _, ok := acmogo.PolicyFor(PostCol); ok {
+		t.Error("expected the policy to be removed")
+	}
+}
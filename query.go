@@ -0,0 +1,196 @@
+package acmogo
+
+import "github.com/globalsign/mgo"
+
+// ReadPermittedFilter returns a query document matching entities
+// whose stored AC lets any of refs read them.
+func ReadPermittedFilter(refs ...Referencer) Map {
+	return PermittedFilter(Read, refs...)
+}
+
+// UpdatePermittedFilter returns a query document matching entities
+// whose stored AC lets any of refs update them.
+func UpdatePermittedFilter(refs ...Referencer) Map {
+	return PermittedFilter(Update, refs...)
+}
+
+// DeletePermittedFilter returns a query document matching entities
+// whose stored AC lets any of refs delete them.
+func DeletePermittedFilter(refs ...Referencer) Map {
+	return PermittedFilter(Delete, refs...)
+}
+
+// PermittedFilter returns a query document matching entities
+// on which any of refs holds perm, including through timed grants
+// in effect at Now(), and none of refs is denied.
+// It matches nothing if perm is not registered. Entities in the trash
+// are not matched.
+//
+// Only the AC stored in each document is used: neither the grants nor the
+// denials entities inherit from their parents are applied, so it can
+// disagree with Permitted for entities with a parent. Use
+// InheritedPermittedFilter to match exactly what Permitted permits.
+func PermittedFilter(perm Permission, refs ...Referencer) Map {
+	filter := permittedFilter(perm, refs)
+	filter[DeletedAtPath] = Map{"$exists": false}
+	return filter
+}
+
+// InheritedPermittedFilter returns a query document matching the entities
+// in col that match filter and on which Permitted reports that any of refs
+// holds perm, inheritance included. filter may be nil.
+//
+// It loads the parents of the entities in col matching filter, and their
+// ancestors, once each to find those that grant or deny perm, so the query
+// is only valid until their ACs change.
+func InheritedPermittedFilter(db *mgo.Database, col string, perm Permission, refs []Referencer, filter Map) (Map, error) {
+	return mgoPersistence(db).InheritedPermittedFilter(col, perm, refs, filter)
+}
+
+func (p Persistence) InheritedPermittedFilter(col string, perm Permission, refs []Referencer, filter Map) (Map, error) {
+	return p.permittedQuery(col, perm, refs, filter, false)
+}
+
+// permittedQuery is InheritedPermittedFilter for the entities
+// in the trash if trashed is true and those out of it otherwise.
+func (p Persistence) permittedQuery(col string, perm Permission, refs []Referencer, filter Map, trashed bool) (Map, error) {
+	inTrash := Map{DeletedAtPath: Map{"$exists": trashed}}
+
+	var children []Entity
+	err := p.Store.Find(col, andFilter(filter, inTrash, Map{
+		ParentPath:    Map{"$exists": true},
+		NoInheritPath: Map{"$ne": true},
+	}), Map{ParentPath: 1}, &children)
+	if err != nil {
+		return nil, err
+	}
+
+	// sort the parents into those whose ancestry grants perm to refs
+	// and those whose ancestry denies refs or is broken
+	var granted, excluded []Reference
+	seen := make(map[Reference]bool)
+	load := p.memoLoader(make(map[Reference]Entity))
+	for _, child := range children {
+		parent := *child.Parent
+		if seen[parent] {
+			continue
+		}
+		seen[parent] = true
+
+		var ac AC
+		err := ac.inherit(load, parent)
+		switch {
+		case err == ErrInheritanceCycle || err == ErrInheritanceDepth:
+			excluded = append(excluded, parent)
+		case err != nil:
+			return nil, err
+		case ac.Denies(refs...):
+			excluded = append(excluded, parent)
+		case ac.Permitted(perm, refs...):
+			granted = append(granted, parent)
+		}
+	}
+	return andFilter(filter, inTrash, inheritedFilter(perm, refs, granted, excluded)), nil
+}
+
+// inheritedFilter matches the entities whose stored AC grants perm to refs
+// unless their parent is excluded, and those that do not deny refs and
+// inherit from a parent that is granted.
+func inheritedFilter(perm Permission, refs []Referencer, granted, excluded []Reference) Map {
+	direct := permittedFilter(perm, refs)
+	if len(excluded) > 0 {
+		direct = andFilter(direct, Map{"$or": []Map{
+			{NoInheritPath: true},
+			{ParentPath: Map{"$nin": excluded}},
+		}})
+	}
+	if len(granted) == 0 {
+		return direct
+	}
+	return Map{"$or": []Map{direct, {
+		ParentPath:    Map{"$in": granted},
+		NoInheritPath: Map{"$ne": true},
+		DeniedPath:    Map{"$nin": refList(refs)},
+	}}}
+}
+
+func permittedFilter(perm Permission, refs []Referencer) Map {
+	granting := perm.granting()
+	if len(granting) == 0 {
+		return Map{"_id": Map{"$exists": false}}
+	}
+	list := refList(refs)
+	or := []Map{{CreatorPath: Map{"$in": list}}}
+	if perm == Read {
+		or = append(or, Map{PublicPath: true})
+	}
+	for _, p := range granting {
+		or = append(or, Map{p.Path(): Map{"$in": list}})
+	}
+	or = append(or, activeGrantFilter(granting, list, Now()))
+	return Map{
+		DeniedPath: Map{"$nin": list},
+		"$or":      or,
+	}
+}
+
+// FindReadPermitted returns a query over col restricted to the
+// documents refs may read. filter may be nil.
+//
+// To apply inheritance it first reads the parent of every document in col
+// matching filter that has one, and then each distinct ancestor once,
+// before the query is returned. On a large collection with many parents
+// pass a selective filter, or use PermittedFilter, which ignores
+// inheritance, to query without the extra reads.
+func FindReadPermitted(db *mgo.Database, col string, refs []Referencer, filter Map) (*mgo.Query, error) {
+	return FindPermitted(db, col, Read, refs, filter)
+}
+
+// FindUpdatePermitted returns a query over col restricted to the
+// documents refs may update. filter may be nil.
+func FindUpdatePermitted(db *mgo.Database, col string, refs []Referencer, filter Map) (*mgo.Query, error) {
+	return FindPermitted(db, col, Update, refs, filter)
+}
+
+// FindDeletePermitted returns a query over col restricted to the
+// documents refs may delete. filter may be nil.
+func FindDeletePermitted(db *mgo.Database, col string, refs []Referencer, filter Map) (*mgo.Query, error) {
+	return FindPermitted(db, col, Delete, refs, filter)
+}
+
+// FindPermitted returns a query over col restricted to the documents on
+// which refs hold perm, inheritance included, using InheritedPermittedFilter.
+// filter may be nil. It reads the parents of the documents first, as
+// described for FindReadPermitted, and returns the error if that fails.
+func FindPermitted(db *mgo.Database, col string, perm Permission, refs []Referencer, filter Map) (*mgo.Query, error) {
+	query, err := InheritedPermittedFilter(db, col, perm, refs, filter)
+	if err != nil {
+		return nil, err
+	}
+	return db.C(col).Find(query), nil
+}
+
+func andFilter(filters ...Map) Map {
+	and := make([]Map, 0, len(filters))
+	for _, filter := range filters {
+		if len(filter) > 0 {
+			and = append(and, filter)
+		}
+	}
+	switch len(and) {
+	case 0:
+		return Map{}
+	case 1:
+		return and[0]
+	}
+	return Map{"$and": and}
+}
+
+// refList never returns nil so the result is safe to use with $in.
+func refList(refs []Referencer) []Reference {
+	list := make([]Reference, 0, len(refs))
+	for _, ref := range refs {
+		list = append(list, ref.Ref())
+	}
+	return list
+}
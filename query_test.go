@@ -0,0 +1,69 @@
+package acmogo_test
+
+import (
+	"testing"
+
+	"github.com/crhntr/acmogo"
+	"github.com/globalsign/mgo"
+)
+
+func TestFindReadPermitted(t *testing.T) {
+	requireDB(t)
+
+	db.C(PostCol).DropCollection()
+
+	user0 := User{Entity: acmogo.New()}
+	user1 := User{Entity: acmogo.New()}
+	team0 := Team{Entity: acmogo.New()}
+
+	post0 := Post{Entity: acmogo.New(), N: 1}
+	post1 := Post{Entity: acmogo.New(), N: 2}
+	post2 := Post{Entity: acmogo.New(), N: 2}
+	post3 := Post{Entity: acmogo.New(), N: 2}
+	post4 := Post{Entity: acmogo.New(), N: 2}
+
+	post0.SetCreator(user0.Ref())
+	post1.PermitRead(user0)
+	post2.PermitDelete(team0)
+	post3.Public = true
+
+	acmogo.InsertList(db, post0, post1, post2, post3, post4)
+
+	refs := []acmogo.Referencer{user0, team0}
+
+	n, err := count(acmogo.FindReadPermitted(db, PostCol, refs, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 {
+		t.Errorf("expected 4 readable posts but got %d", n)
+	}
+
+	n, _ = count(acmogo.FindReadPermitted(db, PostCol, refs, acmogo.Map{"n": 2}))
+	if n != 3 {
+		t.Errorf("expected 3 readable posts with n=2 but got %d", n)
+	}
+
+	n, _ = count(acmogo.FindReadPermitted(db, PostCol, []acmogo.Referencer{user1}, nil))
+	if n != 1 {
+		t.Errorf("expected only the public post but got %d", n)
+	}
+
+	n, _ = count(acmogo.FindUpdatePermitted(db, PostCol, refs, nil))
+	if n != 2 {
+		t.Errorf("expected 2 updatable posts but got %d", n)
+	}
+
+	n, _ = count(acmogo.FindDeletePermitted(db, PostCol, []acmogo.Referencer{team0}, nil))
+	if n != 1 {
+		t.Errorf("expected 1 deletable post but got %d", n)
+	}
+}
+
+// count counts the documents q matches, if err is nil.
+func count(q *mgo.Query, err error) (int, error) {
+	if err != nil {
+		return 0, err
+	}
+	return q.Count()
+}
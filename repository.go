@@ -0,0 +1,124 @@
+package acmogo
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	"github.com/globalsign/mgo"
+)
+
+var (
+	ErrForbidden = errors.New("forbidden")
+
+	// ErrNotFound is mgo.ErrNotFound so errors returned by the
+	// mgo backed functions compare equal to either.
+	ErrNotFound = mgo.ErrNotFound
+)
+
+// Repository reads and writes entities on behalf of a principal.
+// Updates and deletes carry the permission check in their selector
+// so the check and the write happen atomically. The access an entity
+// inherits is resolved, with InheritedPermittedFilter, just before.
+type Repository struct {
+	p    Persistence
+	refs []Referencer
+}
+
+// NewRepository returns a Repository acting as refs. The refs are usually
+// the principal's own reference followed by the references it acts through.
+func NewRepository(db *mgo.Database, refs ...Referencer) Repository {
+	return mgoPersistence(db).NewRepository(refs...)
+}
+
+func (p Persistence) NewRepository(refs ...Referencer) Repository {
+	return Repository{p: p, refs: refs}
+}
+
+// WithContext returns a copy of repo whose operations honor
+// the deadline and cancellation of ctx.
+func (repo Repository) WithContext(ctx context.Context) Repository {
+	repo.p = repo.p.WithContext(ctx)
+	return repo
+}
+
+// Get loads entity, which must be a pointer, if it may be read.
+func (repo Repository) Get(entity Referencer) error {
+	ref := entity.Ref()
+	query, err := repo.filter(ref, Read)
+	if err != nil {
+		return err
+	}
+	err = repo.p.findOne(ref.Col, query, entity)
+	return repo.permissionErr(ref, err)
+}
+
+// Find loads the documents in col matching filter that may be read
+// into results, which must be a pointer to a slice. filter may be nil.
+func (repo Repository) Find(col string, filter Map, results interface{}) error {
+	return repo.p.FindPermitted(col, Read, repo.refs, filter, results)
+}
+
+// Update applies updateDoc to entity if it may be updated,
+// stamping it as UpdateEntity does.
+func (repo Repository) Update(entity Referencer, updateDoc Map) error {
+	ref := entity.Ref()
+	query, err := repo.filter(ref, Update)
+	if err != nil {
+		return err
+	}
+	err = repo.p.updateStamped(ref, query, updateDoc)
+	return repo.permissionErr(ref, err)
+}
+
+// Delete removes entity if it may be deleted.
+func (repo Repository) Delete(entity Referencer) error {
+	ref := entity.Ref()
+	query, err := repo.filter(ref, Delete)
+	if err != nil {
+		return err
+	}
+	err = repo.p.remove(ref, query)
+	return repo.permissionErr(ref, err)
+}
+
+// Insert stores entities created by the first of the refs of repo
+// with InsertAs, applying the policies of their collections.
+// It stops at the first failure.
+func (repo Repository) Insert(entities ...Controlled) error {
+	if len(repo.refs) == 0 {
+		return errors.New("acmogo: repository has no principal to insert as")
+	}
+	_, err := repo.p.InsertAs(repo.refs[0], entities...)
+	return err
+}
+
+// filter matches the entity ref if the refs of repo hold perm on it.
+func (repo Repository) filter(ref Reference, perm Permission) (Map, error) {
+	return repo.p.InheritedPermittedFilter(ref.Col, perm, repo.refs, Map{"_id": ref.ID})
+}
+
+// permissionErr returns ErrNotFound if the entity ref the query of an
+// operation did not match is missing or in the trash, and ErrForbidden
+// if it may not be accessed.
+func (repo Repository) permissionErr(ref Reference, err error) error {
+	return repo.p.trashErr(ref, err, false)
+}
+
+// findOne loads the first document in col matching query into result,
+// which must be a pointer. It returns ErrNotFound if none matches.
+func (p Persistence) findOne(col string, query Map, result interface{}) error {
+	v := reflect.ValueOf(result)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return errors.New("acmogo: result argument must be a pointer")
+	}
+	results := reflect.New(reflect.SliceOf(v.Elem().Type()))
+	if err := p.Store.Find(col, query, nil, results.Interface()); err != nil {
+		return err
+	}
+	if results.Elem().Len() == 0 {
+		return ErrNotFound
+	}
+	v.Elem().Set(results.Elem().Index(0))
+	return nil
+}
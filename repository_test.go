@@ -0,0 +1,107 @@
+package acmogo_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/crhntr/acmogo"
+	"github.com/crhntr/acmogo/memstore"
+)
+
+func TestRepository(t *testing.T) {
+	requireDB(t)
+
+	user0 := User{Entity: acmogo.New()}
+	user1 := User{Entity: acmogo.New()}
+	post0 := Post{Entity: acmogo.New()}
+	post1 := Post{Entity: acmogo.New()}
+
+	post0.SetCreator(user0.Ref())
+	post0.PermitRead(user1)
+
+	repo0 := acmogo.NewRepository(db, user0)
+	repo1 := acmogo.NewRepository(db, user1)
+
+	if err := repo0.Insert(&post0); err != nil {
+		t.Fatal(err)
+	}
+
+	var loaded Post
+	loaded.ID = post0.ID
+	if err := repo1.Get(&loaded); err != nil {
+		t.Errorf("get should be permitted: %s", err)
+	}
+	if err := repo1.Update(post0, acmogo.Map{"$set": acmogo.Map{"n": 1}}); err != acmogo.ErrForbidden {
+		t.Errorf("update should be forbidden but got %v", err)
+	}
+	if err := repo1.Delete(post0); err != acmogo.ErrForbidden {
+		t.Errorf("delete should be forbidden but got %v", err)
+	}
+	if err := repo0.Update(post0, acmogo.Map{"$set": acmogo.Map{"n": 1}}); err != nil {
+		t.Errorf("update should be permitted: %s", err)
+	}
+	if err := repo0.Get(&loaded); err != nil || loaded.N != 1 {
+		t.Errorf("expected updated post but got %v (err: %v)", loaded.N, err)
+	}
+
+	var found []Post
+	if err := repo1.Find(PostCol, acmogo.Map{"_id": post0.ID}, &found); err != nil || len(found) != 1 {
+		t.Errorf("expected post to be found (err: %v)", err)
+	}
+
+	if err := repo0.Get(&post1); err != acmogo.ErrNotFound {
+		t.Errorf("expected not found but got %v", err)
+	}
+
+	if err := repo0.Delete(post0); err != nil {
+		t.Errorf("delete should be permitted: %s", err)
+	}
+	if err := repo0.Get(&loaded); err != acmogo.ErrNotFound {
+		t.Errorf("expected not found after delete but got %v", err)
+	}
+}
+
+func TestPersistence_NewRepository(t *testing.T) {
+	p := memstore.New().Persistence()
+	user0 := User{Entity: acmogo.New()}
+	team0 := Team{Entity: acmogo.New()}
+	post0 := Post{Entity: acmogo.New()}
+	post1 := Post{Entity: acmogo.New()}
+
+	team0.PermitUpdate(user0)
+	post0.SetParent(team0.Ref())
+	p.InsertList(team0, post0, post1)
+
+	repo := p.NewRepository(user0)
+	if err := repo.Update(post0, acmogo.Map{"$set": acmogo.Map{"n": 1}}); err != nil {
+		t.Errorf("update should be inherited from the team: %s", err)
+	}
+	var loaded Post
+	loaded.ID = post0.ID
+	if err := repo.Get(&loaded); err != nil || loaded.N != 1 {
+		t.Errorf("expected the updated post but got %v (err: %v)", loaded.N, err)
+	}
+	if err := repo.Delete(post0); err != acmogo.ErrForbidden {
+		t.Errorf("delete should be forbidden but got %v", err)
+	}
+	if err := repo.Get(&post1); err != acmogo.ErrForbidden {
+		t.Errorf("expected forbidden but got %v", err)
+	}
+
+	post2 := Post{Entity: acmogo.New()}
+	if err := repo.Insert(&post2); err != nil {
+		t.Fatal(err)
+	}
+	if post2.Creator == nil || *post2.Creator != user0.Ref() || !p.DeletePermitted(post2, user0) {
+		t.Errorf("expected the repository principal to be stamped as the creator but got %+v", post2.AC)
+	}
+	if err := p.NewRepository().Insert(&Post{Entity: acmogo.New()}); err == nil {
+		t.Error("expected a repository without principals not to insert")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := repo.WithContext(ctx).Get(&loaded); err != context.Canceled {
+		t.Errorf("expected the cancelled context to stop the read but got %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package acmogo
+
+import (
+	"errors"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+)
+
+var ErrMembershipCycle = errors.New("membership cycle")
+
+// PrincipalResolver expands a reference into every reference it acts as.
+// The result includes the reference itself.
+type PrincipalResolver interface {
+	Resolve(ref Reference) ([]Reference, error)
+}
+
+// ResolvePrincipals expands and deduplicates refs using resolver.
+// The result can be passed directly to the permission checks.
+func ResolvePrincipals(resolver PrincipalResolver, refs ...Referencer) ([]Referencer, error) {
+	var all []Reference
+	for _, ref := range refs {
+		resolved, err := resolver.Resolve(ref.Ref())
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, resolved...)
+	}
+	all = DedupReferenceList(all)
+	principals := make([]Referencer, len(all))
+	for i, ref := range all {
+		principals[i] = ref
+	}
+	return principals, nil
+}
+
+// Membership describes where documents in Col store the groups they belong to.
+// Field is a top level field holding either ObjectIds of documents in GroupCol
+// or, when GroupCol is empty, References.
+type Membership struct {
+	Col      string
+	Field    string
+	GroupCol string
+}
+
+// MembershipResolver is a PrincipalResolver that reads group membership
+// from the database. Groups may themselves be members of other groups.
+// It caches every lookup so it should live no longer than a request.
+type MembershipResolver struct {
+	p           Persistence
+	memberships map[string][]Membership
+	groups      map[Reference][]Reference
+}
+
+func NewMembershipResolver(db *mgo.Database, memberships ...Membership) *MembershipResolver {
+	return mgoPersistence(db).NewMembershipResolver(memberships...)
+}
+
+func (p Persistence) NewMembershipResolver(memberships ...Membership) *MembershipResolver {
+	res := &MembershipResolver{
+		p:           p,
+		memberships: make(map[string][]Membership),
+		groups:      make(map[Reference][]Reference),
+	}
+	for _, m := range memberships {
+		res.memberships[m.Col] = append(res.memberships[m.Col], m)
+	}
+	return res
+}
+
+// Resolve returns ref followed by every group it belongs to directly or
+// through nested groups. It returns ErrMembershipCycle if a group
+// is (indirectly) a member of itself.
+func (res *MembershipResolver) Resolve(ref Reference) ([]Reference, error) {
+	resolved := []Reference{ref}
+	visited := map[Reference]bool{ref: true}
+	if err := res.resolve(ref, []Reference{ref}, visited, &resolved); err != nil {
+		return nil, err
+	}
+	return resolved, nil
+}
+
+func (res *MembershipResolver) resolve(ref Reference, path []Reference, visited map[Reference]bool, resolved *[]Reference) error {
+	groups, err := res.directGroups(ref)
+	if err != nil {
+		return err
+	}
+	for _, group := range groups {
+		for _, p := range path {
+			if p == group {
+				return ErrMembershipCycle
+			}
+		}
+		if visited[group] {
+			continue
+		}
+		visited[group] = true
+		*resolved = append(*resolved, group)
+		if err := res.resolve(group, append(path, group), visited, resolved); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (res *MembershipResolver) directGroups(ref Reference) ([]Reference, error) {
+	if groups, ok := res.groups[ref]; ok {
+		return groups, nil
+	}
+	var groups []Reference
+	for _, m := range res.memberships[ref.Col] {
+		var doc bson.M
+		err := res.p.Store.FindId(ref.Col, ref.ID, Map{m.Field: 1}, &doc)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, m.references(doc[m.Field])...)
+	}
+	res.groups[ref] = groups
+	return groups, nil
+}
+
+func (m Membership) references(value interface{}) []Reference {
+	values, ok := value.([]interface{})
+	if !ok {
+		values = []interface{}{value}
+	}
+	var refs []Reference
+	for _, v := range values {
+		switch v := v.(type) {
+		case bson.ObjectId:
+			if m.GroupCol != "" {
+				refs = append(refs, Reference{m.GroupCol, v})
+			}
+		case bson.M:
+			col, _ := v["c"].(string)
+			id, _ := v["id"].(bson.ObjectId)
+			if ref := (Reference{col, id}); ref.Validate() == nil {
+				refs = append(refs, ref)
+			}
+		}
+	}
+	return refs
+}
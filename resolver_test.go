@@ -0,0 +1,47 @@
+package acmogo_test
+
+import (
+	"testing"
+
+	"github.com/crhntr/acmogo"
+	"github.com/globalsign/mgo/bson"
+)
+
+func TestMembershipResolver(t *testing.T) {
+	requireDB(t)
+
+	team0 := Team{Entity: acmogo.New()}
+	team1 := Team{Entity: acmogo.New()}
+	user0 := User{Entity: acmogo.New(), Teams: []bson.ObjectId{team0.ID}}
+	post0 := Post{Entity: acmogo.New()}
+
+	post0.PermitRead(team1)
+	acmogo.InsertList(db, user0, team0, team1, post0)
+	db.C(TeamCol).UpdateId(team0.ID, mp{"$set": mp{"parents": []acmogo.Reference{team1.Ref()}}})
+
+	resolver := acmogo.NewMembershipResolver(db,
+		acmogo.Membership{Col: UserCol, Field: "teams", GroupCol: TeamCol},
+		acmogo.Membership{Col: TeamCol, Field: "parents"},
+	)
+
+	refs, err := acmogo.ResolvePrincipals(resolver, user0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != 3 {
+		t.Fatalf("expected user and two teams but got %v", refs)
+	}
+	if !post0.ReadPermitted(refs...) {
+		t.Error("read should be permitted through nested team")
+	}
+
+	db.C(TeamCol).UpdateId(team1.ID, mp{"$set": mp{"parents": []acmogo.Reference{team0.Ref()}}})
+
+	resolver = acmogo.NewMembershipResolver(db,
+		acmogo.Membership{Col: UserCol, Field: "teams", GroupCol: TeamCol},
+		acmogo.Membership{Col: TeamCol, Field: "parents"},
+	)
+	if _, err := resolver.Resolve(user0.Ref()); err != acmogo.ErrMembershipCycle {
+		t.Errorf("expected membership cycle error but got %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package acmogo
+
+import (
+	"strings"
+
+	"github.com/globalsign/mgo"
+)
+
+// Revocation counts the documents of a collection RevokeEverywhere changed.
+type Revocation struct {
+	Revoked    int `json:"revoked"`
+	Reassigned int `json:"reassigned"`
+}
+
+// RevokeEverywhere removes every permission granted to principal, including
+// timed grants, from the documents in collections. If no collections are
+// given it revokes in every collection of db except AuditCol and the
+// system collections. Denials of principal are kept.
+//
+// A creator holds every permission, so if heir is not nil documents created
+// by principal are given heir as their creator. Otherwise they are left as is.
+// It returns the number of documents changed in each collection.
+func RevokeEverywhere(db *mgo.Database, principal, heir Referencer, collections ...string) (map[string]Revocation, error) {
+	if len(collections) == 0 {
+		names, err := db.CollectionNames()
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			if name != AuditCol && !strings.HasPrefix(name, "system.") {
+				collections = append(collections, name)
+			}
+		}
+	}
+	return mgoPersistence(db).RevokeEverywhere(principal, heir, collections...)
+}
+
+func (p Persistence) RevokeEverywhere(principal, heir Referencer, collections ...string) (map[string]Revocation, error) {
+	ref := principal.Ref()
+	var transfer Map
+	if heir != nil {
+		var err error
+		if transfer, err = transferUpdateDoc(ref, heir.Ref(), ""); err != nil {
+			return nil, err
+		}
+	}
+
+	granted := []Map{{TimedPath + ".ref": ref}}
+	pull := Map{TimedPath: Map{"ref": ref}}
+	for _, perm := range Permissions() {
+		granted = append(granted, Map{perm.Path(): ref})
+		pull[perm.Path()] = ref
+	}
+
+	revocations := make(map[string]Revocation, len(collections))
+	for _, col := range collections {
+		var r Revocation
+		var err error
+		if transfer != nil {
+			r.Reassigned, err = p.updateAll(col, Map{CreatorPath: ref}, transfer)
+			if err != nil {
+				return revocations, err
+			}
+		}
+		r.Revoked, err = p.updateAll(col, Map{"$or": granted}, Map{"$pull": pull})
+		revocations[col] = r
+		if err != nil {
+			return revocations, err
+		}
+	}
+	return revocations, nil
+}
@@ -0,0 +1,49 @@
+package acmogo_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/crhntr/acmogo"
+	"github.com/crhntr/acmogo/memstore"
+)
+
+func TestRevokeEverywhere(t *testing.T) {
+	p := memstore.New().Persistence()
+	user0 := User{Entity: acmogo.New()}
+	user1 := User{Entity: acmogo.New()}
+	user2 := User{Entity: acmogo.New()}
+	post0 := Post{Entity: acmogo.New()}
+	post1 := Post{Entity: acmogo.New()}
+	post2 := Post{Entity: acmogo.New()}
+	team0 := Team{Entity: acmogo.New()}
+
+	post0.PermitRead(user0, user2)
+	post1.PermitUntil(acmogo.Read, time.Now().Add(time.Hour), user0)
+	post2.SetCreator(user0.Ref())
+	team0.Permit(Comment, user0)
+	p.InsertList(post0, post1, post2, team0)
+
+	revocations, err := p.RevokeEverywhere(user0, user1, PostCol, TeamCol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := revocations[PostCol]; r.Revoked != 2 || r.Reassigned != 1 {
+		t.Errorf("unexpected revocation in %s: %+v", PostCol, r)
+	}
+	if r := revocations[TeamCol]; r.Revoked != 1 || r.Reassigned != 0 {
+		t.Errorf("unexpected revocation in %s: %+v", TeamCol, r)
+	}
+
+	for _, entity := range []acmogo.Referencer{post0, post1, post2, team0} {
+		if p.ReadPermitted(entity, user0) {
+			t.Errorf("expected read of %s to be revoked", entity.Ref().Col)
+		}
+	}
+	if !p.ReadPermitted(post0, user2) {
+		t.Error("expected other readers to keep access")
+	}
+	if !p.DeletePermitted(post2, user1) {
+		t.Error("expected the heir to become the creator")
+	}
+}
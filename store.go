@@ -0,0 +1,387 @@
+package acmogo
+
+import (
+	"context"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+)
+
+// Store is the storage acmogo needs from a database.
+// FindId, UpdateId and Update return ErrNotFound when no document matches.
+// UpdateAll and RemoveAll return the number of documents they changed.
+type Store interface {
+	Insert(col string, doc interface{}) error
+	FindId(col string, id bson.ObjectId, projection Map, result interface{}) error
+	UpdateId(col string, id bson.ObjectId, update Map) error
+	Update(col string, selector, update Map) error
+	UpdateAll(col string, selector, update Map) (int, error)
+	RemoveAll(col string, selector Map) (int, error)
+	Find(col string, filter, projection Map, results interface{}) error
+}
+
+// ContextStore is a Store that can run its operations under a context.
+type ContextStore interface {
+	Store
+	WithContext(ctx context.Context) Store
+}
+
+// MgoStore is a Store on top of globalsign/mgo.
+type MgoStore struct {
+	DB  *mgo.Database
+	ctx context.Context
+}
+
+// WithContext returns a copy of s that runs every operation on a copy
+// of its session with socket and sync timeouts ending at the deadline
+// of ctx, and fails with the error of ctx once it is done.
+func (s MgoStore) WithContext(ctx context.Context) Store {
+	s.ctx = ctx
+	return s
+}
+
+// c calls f with col on a session honoring the context of s.
+func (s MgoStore) c(col string, f func(c *mgo.Collection) error) error {
+	if s.ctx == nil {
+		return f(s.DB.C(col))
+	}
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	session := s.DB.Session.Copy()
+	defer session.Close()
+	if deadline, ok := s.ctx.Deadline(); ok {
+		timeout := time.Until(deadline)
+		if timeout <= 0 {
+			return context.DeadlineExceeded
+		}
+		session.SetSocketTimeout(timeout)
+		session.SetSyncTimeout(timeout)
+	}
+	return f(s.DB.With(session).C(col))
+}
+
+func (s MgoStore) Insert(col string, doc interface{}) error {
+	return s.c(col, func(c *mgo.Collection) error {
+		return c.Insert(doc)
+	})
+}
+
+func (s MgoStore) InsertMany(col string, ordered bool, docs []interface{}) (map[int]error, error) {
+	err := s.c(col, func(c *mgo.Collection) error {
+		bulk := c.Bulk()
+		if !ordered {
+			bulk.Unordered()
+		}
+		bulk.Insert(docs...)
+		_, err := bulk.Run()
+		return err
+	})
+	return bulkFailures(err)
+}
+
+// bulkCases is implemented by *mgo.BulkError.
+type bulkCases interface {
+	Cases() []mgo.BulkErrorCase
+}
+
+// bulkFailures sorts the error of an mgo bulk insert into the documents
+// the server rejected, whose cases carry a *mgo.QueryError, and an error
+// leaving the outcome of the others unknown. mgo tags every document of
+// a batch that failed as a whole, for example with a write concern or
+// network error, with that error, so those cases are not failures.
+func bulkFailures(err error) (map[int]error, error) {
+	failed := make(map[int]error)
+	bulkErr, ok := err.(bulkCases)
+	if !ok {
+		return failed, err
+	}
+	var unknown error
+	for _, c := range bulkErr.Cases() {
+		if qerr, ok := c.Err.(*mgo.QueryError); ok && c.Index >= 0 {
+			failed[c.Index] = qerr
+		} else if unknown == nil {
+			unknown = c.Err
+		}
+	}
+	return failed, unknown
+}
+
+func (s MgoStore) FindId(col string, id bson.ObjectId, projection Map, result interface{}) error {
+	return s.c(col, func(c *mgo.Collection) error {
+		q := c.FindId(id)
+		if projection != nil {
+			q = q.Select(projection)
+		}
+		return q.One(result)
+	})
+}
+
+func (s MgoStore) UpdateId(col string, id bson.ObjectId, update Map) error {
+	return s.c(col, func(c *mgo.Collection) error {
+		return c.UpdateId(id, update)
+	})
+}
+
+func (s MgoStore) Update(col string, selector, update Map) error {
+	return s.c(col, func(c *mgo.Collection) error {
+		return c.Update(selector, update)
+	})
+}
+
+func (s MgoStore) UpdateAll(col string, selector, update Map) (int, error) {
+	var updated int
+	err := s.c(col, func(c *mgo.Collection) error {
+		info, err := c.UpdateAll(selector, update)
+		if info != nil {
+			updated = info.Updated
+		}
+		return err
+	})
+	return updated, err
+}
+
+func (s MgoStore) RemoveAll(col string, selector Map) (int, error) {
+	var removed int
+	err := s.c(col, func(c *mgo.Collection) error {
+		info, err := c.RemoveAll(selector)
+		if info != nil {
+			removed = info.Removed
+		}
+		return err
+	})
+	return removed, err
+}
+
+func (s MgoStore) Find(col string, filter, projection Map, results interface{}) error {
+	return s.c(col, func(c *mgo.Collection) error {
+		q := c.Find(filter)
+		if projection != nil {
+			q = q.Select(projection)
+		}
+		return q.All(results)
+	})
+}
+
+// Persistence runs the persistence functions against any Store.
+// The package level functions taking an *mgo.Database are shorthand
+// for the methods of a Persistence backed by an MgoStore.
+type Persistence struct {
+	Store Store
+
+	// Cache, if set, holds the entities loaded for permission checks.
+	// The methods of Persistence invalidate it when they change a document;
+	// see ACCache for the changes that do not.
+	Cache *ACCache
+
+	uncached bool
+}
+
+func mgoPersistence(db *mgo.Database) Persistence {
+	return Persistence{Store: MgoStore{DB: db}}
+}
+
+// WithContext returns a Persistence on db whose operations honor
+// the deadline and cancellation of ctx.
+//
+// The administrative functions that only take an *mgo.Database, such as
+// EnsureIndexes, ApplyValidator, ScanOrphans and the collection discovery
+// of RevokeEverywhere, do not take a context. Bound them with the socket
+// timeout of the session of db instead.
+func WithContext(ctx context.Context, db *mgo.Database) Persistence {
+	return mgoPersistence(db).WithContext(ctx)
+}
+
+// WithContext returns a copy of p whose operations honor the deadline
+// and cancellation of ctx. A Store that is not a ContextStore is only
+// checked for cancellation before each operation.
+func (p Persistence) WithContext(ctx context.Context) Persistence {
+	if s, ok := p.Store.(ContextStore); ok {
+		p.Store = s.WithContext(ctx)
+		return p
+	}
+	p.Store = contextStore{p.Store, ctx}
+	return p
+}
+
+// contextStore fails every operation of Store once ctx is done.
+type contextStore struct {
+	Store
+	ctx context.Context
+}
+
+func (s contextStore) WithContext(ctx context.Context) Store {
+	s.ctx = ctx
+	return s
+}
+
+func (s contextStore) Insert(col string, doc interface{}) error {
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	return s.Store.Insert(col, doc)
+}
+
+func (s contextStore) InsertMany(col string, ordered bool, docs []interface{}) (map[int]error, error) {
+	if bs, ok := s.Store.(BulkStore); ok && s.ctx.Err() == nil {
+		return bs.InsertMany(col, ordered, docs)
+	}
+	// once ctx is done every insert fails with its error
+	return insertEach(s, col, ordered, docs), nil
+}
+
+func (s contextStore) FindId(col string, id bson.ObjectId, projection Map, result interface{}) error {
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	return s.Store.FindId(col, id, projection, result)
+}
+
+func (s contextStore) UpdateId(col string, id bson.ObjectId, update Map) error {
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	return s.Store.UpdateId(col, id, update)
+}
+
+func (s contextStore) Update(col string, selector, update Map) error {
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	return s.Store.Update(col, selector, update)
+}
+
+func (s contextStore) UpdateAll(col string, selector, update Map) (int, error) {
+	if err := s.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return s.Store.UpdateAll(col, selector, update)
+}
+
+func (s contextStore) RemoveAll(col string, selector Map) (int, error) {
+	if err := s.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return s.Store.RemoveAll(col, selector)
+}
+
+func (s contextStore) Find(col string, filter, projection Map, results interface{}) error {
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	return s.Store.Find(col, filter, projection, results)
+}
+
+// FindPermitted loads the documents in col on which refs hold perm,
+// inheritance included, into results, which must be a pointer to a slice.
+// filter may be nil.
+func (p Persistence) FindPermitted(col string, perm Permission, refs []Referencer, filter Map, results interface{}) error {
+	query, err := p.InheritedPermittedFilter(col, perm, refs, filter)
+	if err != nil {
+		return err
+	}
+	return p.Store.Find(col, query, nil, results)
+}
+
+// selectorErr tells apart a document that does not exist from one
+// an update selector excluded, returning ErrNotFound or excluded
+// respectively. Errors other than ErrNotFound are returned as is.
+func (p Persistence) selectorErr(ref Reference, err, excluded error) error {
+	if err != ErrNotFound {
+		return err
+	}
+	var ent Entity
+	if err := p.Store.FindId(ref.Col, ref.ID, Map{"_id": 1}, &ent); err != nil {
+		return err
+	}
+	return excluded
+}
+
+// loadLive is like loadEntity but returns ErrNotFound for an entity in the trash.
+func (p Persistence) loadLive(ref Reference) (Entity, error) {
+	ent, err := p.loadEntity(ref)
+	if err == nil && ent.Trashed() {
+		return Entity{}, ErrNotFound
+	}
+	return ent, err
+}
+
+// Uncached returns a copy of p whose permission checks read from the
+// Store rather than the Cache. Its changes still invalidate the Cache.
+func (p Persistence) Uncached() Persistence {
+	p.uncached = true
+	return p
+}
+
+// loadEntity loads the SelectEntityDoc fields of the document ref points to.
+func (p Persistence) loadEntity(ref Reference) (Entity, error) {
+	cache := p.Cache != nil && !p.uncached
+	if cache {
+		if ent, ok := p.Cache.Get(ref); ok {
+			return ent, nil
+		}
+	}
+	var gen uint64
+	if cache {
+		gen = p.Cache.Generation()
+	}
+	var ent Entity
+	err := p.Store.FindId(ref.Col, ref.ID, toMap(SelectEntityDoc), &ent)
+	if err == nil && cache {
+		p.Cache.AddSince(ref, ent, gen)
+	}
+	return ent, err
+}
+
+// updateId, update, updateAll, remove and removeAll change documents in
+// the Store and invalidate the entries of the Cache they may have changed.
+
+func (p Persistence) updateId(ref Reference, update Map) error {
+	if p.Cache != nil {
+		defer p.Cache.Invalidate(ref)
+	}
+	return p.Store.UpdateId(ref.Col, ref.ID, update)
+}
+
+func (p Persistence) update(ref Reference, selector, update Map) error {
+	if p.Cache != nil {
+		defer p.Cache.Invalidate(ref)
+	}
+	return p.Store.Update(ref.Col, selector, update)
+}
+
+func (p Persistence) updateAll(col string, selector, update Map) (int, error) {
+	if p.Cache != nil {
+		defer p.Cache.InvalidateCol(col)
+	}
+	return p.Store.UpdateAll(col, selector, update)
+}
+
+// remove removes the entity ref if it matches selector
+// and returns ErrNotFound if it does not.
+func (p Persistence) remove(ref Reference, selector Map) error {
+	if p.Cache != nil {
+		defer p.Cache.Invalidate(ref)
+	}
+	n, err := p.Store.RemoveAll(ref.Col, andFilter(Map{"_id": ref.ID}, selector))
+	if err == nil && n == 0 {
+		err = ErrNotFound
+	}
+	return err
+}
+
+func (p Persistence) removeAll(col string, selector Map) (int, error) {
+	if p.Cache != nil {
+		defer p.Cache.InvalidateCol(col)
+	}
+	return p.Store.RemoveAll(col, selector)
+}
+
+func toMap(selector map[string]int) Map {
+	m := make(Map, len(selector))
+	for k, v := range selector {
+		m[k] = v
+	}
+	return m
+}
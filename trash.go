@@ -0,0 +1,113 @@
+package acmogo
+
+import (
+	"time"
+
+	"github.com/globalsign/mgo"
+)
+
+// Trashed reports whether the entity is in the trash.
+func (ent Entity) Trashed() bool {
+	return ent.DeletedAt != nil
+}
+
+// SoftDelete moves the stored entity to the trash if refs may delete it,
+// recording when and by refs[0] it was deleted. Entities in the trash are
+// ignored by the permission checks and filters until they are restored.
+// It returns ErrForbidden if refs may not delete the entity and
+// ErrNotFound if it does not exist or already is in the trash.
+func SoftDelete(db *mgo.Database, entity Referencer, refs ...Referencer) error {
+	return mgoPersistence(db).SoftDelete(entity, refs...)
+}
+
+func (p Persistence) SoftDelete(entity Referencer, refs ...Referencer) error {
+	ref := entity.Ref()
+	selector, err := p.permittedQuery(ref.Col, Delete, refs, Map{"_id": ref.ID}, false)
+	if err != nil {
+		return err
+	}
+	set := Map{DeletedAtPath: Now()}
+	if len(refs) > 0 {
+		set[DeletedByPath] = refs[0].Ref()
+	}
+	err = p.update(ref, selector, Map{"$set": set})
+	return p.trashErr(ref, err, false)
+}
+
+// Restore takes the stored entity out of the trash if refs may delete it.
+// It returns ErrForbidden if refs may not delete the entity and
+// ErrNotFound if it does not exist or is not in the trash.
+func Restore(db *mgo.Database, entity Referencer, refs ...Referencer) error {
+	return mgoPersistence(db).Restore(entity, refs...)
+}
+
+func (p Persistence) Restore(entity Referencer, refs ...Referencer) error {
+	ref := entity.Ref()
+	selector, err := p.permittedQuery(ref.Col, Delete, refs, Map{"_id": ref.ID}, true)
+	if err != nil {
+		return err
+	}
+	err = p.update(ref, selector, Map{
+		"$unset": Map{DeletedAtPath: "", DeletedByPath: ""},
+	})
+	return p.trashErr(ref, err, true)
+}
+
+// trashErr is selectorErr for an update of the entity ref selecting it
+// in the trash if trashed is true and out of it otherwise. It tells an
+// entity that is missing or in the other state from one that may not
+// be deleted.
+func (p Persistence) trashErr(ref Reference, err error, trashed bool) error {
+	if err != ErrNotFound {
+		return err
+	}
+	ent, err := p.Uncached().loadEntity(ref)
+	if err != nil {
+		return err
+	}
+	if ent.Trashed() != trashed {
+		return ErrNotFound
+	}
+	return ErrForbidden
+}
+
+// PurgeTrash removes the entities in col that have been
+// in the trash for longer than retention.
+// It returns the number of documents removed.
+func PurgeTrash(db *mgo.Database, col string, retention time.Duration) (int, error) {
+	return mgoPersistence(db).PurgeTrash(col, retention)
+}
+
+func (p Persistence) PurgeTrash(col string, retention time.Duration) (int, error) {
+	return p.removeAll(col, Map{DeletedAtPath: Map{"$lt": Now().Add(-retention)}})
+}
+
+// TrashFilter returns a query document matching the entities in the
+// trash whose stored AC lets refs restore them. Like PermittedFilter
+// it does not apply inheritance; FindTrash does.
+func TrashFilter(refs ...Referencer) Map {
+	filter := permittedFilter(Delete, refs)
+	filter[DeletedAtPath] = Map{"$exists": true}
+	return filter
+}
+
+// FindTrash returns a query over the documents in col in the trash
+// that refs may restore, inheritance included. filter may be nil.
+// Like FindPermitted it reads their parents first.
+func FindTrash(db *mgo.Database, col string, refs []Referencer, filter Map) (*mgo.Query, error) {
+	query, err := mgoPersistence(db).permittedQuery(col, Delete, refs, filter, true)
+	if err != nil {
+		return nil, err
+	}
+	return db.C(col).Find(query), nil
+}
+
+// FindTrash loads the documents in col in the trash that refs may restore
+// into results, which must be a pointer to a slice. filter may be nil.
+func (p Persistence) FindTrash(col string, refs []Referencer, filter Map, results interface{}) error {
+	query, err := p.permittedQuery(col, Delete, refs, filter, true)
+	if err != nil {
+		return err
+	}
+	return p.Store.Find(col, query, nil, results)
+}
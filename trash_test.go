@@ -0,0 +1,127 @@
+package acmogo_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/crhntr/acmogo"
+	"github.com/crhntr/acmogo/memstore"
+)
+
+func TestSoftDelete(t *testing.T) {
+	deleted := time.Date(2019, time.March, 1, 12, 0, 0, 0, time.UTC)
+	now := acmogo.Now
+	defer func() { acmogo.Now = now }()
+	acmogo.Now = func() time.Time { return deleted }
+
+	p := memstore.New().Persistence()
+	user0 := User{Entity: acmogo.New()}
+	user1 := User{Entity: acmogo.New()}
+	post0 := Post{Entity: acmogo.New()}
+	post1 := Post{Entity: acmogo.New()}
+	post0.PermitDelete(user0)
+	post0.PermitRead(user1)
+	post1.PermitDelete(user0)
+	p.InsertList(post0, post1)
+
+	if err := p.SoftDelete(post0, user1); err != acmogo.ErrForbidden {
+		t.Errorf("expected a reader to be forbidden but got %v", err)
+	}
+	if err := p.SoftDelete(post0, user0); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SoftDelete(post0, user0); err != acmogo.ErrNotFound {
+		t.Errorf("expected a trashed entity not to be found but got %v", err)
+	}
+
+	p.RefreshEntity(&post0)
+	if !post0.Trashed() || !post0.DeletedAt.Equal(deleted) || *post0.DeletedBy != user0.Ref() {
+		t.Errorf("expected the deletion to be recorded but got %+v", post0.Entity)
+	}
+	if p.ReadPermitted(post0, user1) {
+		t.Error("expected a trashed entity not to be readable")
+	}
+
+	var posts []Post
+	p.FindPermitted(PostCol, acmogo.Read, []acmogo.Referencer{user0, user1}, nil, &posts)
+	if len(posts) != 1 || posts[0].ID != post1.ID {
+		t.Errorf("expected only the live post to be found but got %d", len(posts))
+	}
+	p.FindTrash(PostCol, []acmogo.Referencer{user0}, nil, &posts)
+	if len(posts) != 1 || posts[0].ID != post0.ID {
+		t.Errorf("expected the trashed post to be found but got %d", len(posts))
+	}
+
+	if err := p.Restore(post1, user0); err != acmogo.ErrNotFound {
+		t.Errorf("expected a live entity not to be restored but got %v", err)
+	}
+	if err := p.Restore(post0, user1); err != acmogo.ErrForbidden {
+		t.Errorf("expected a reader to be forbidden but got %v", err)
+	}
+	if err := p.Restore(post0, user0); err != nil {
+		t.Fatal(err)
+	}
+	if !p.ReadPermitted(post0, user1) {
+		t.Error("expected a restored entity to be readable")
+	}
+
+	p.SoftDelete(post0, user0)
+	acmogo.Now = func() time.Time { return deleted.Add(24 * time.Hour) }
+	p.SoftDelete(post1, user0)
+	if n, err := p.PurgeTrash(PostCol, 12*time.Hour); err != nil || n != 1 {
+		t.Errorf("expected 1 post to be purged but got %d (err: %v)", n, err)
+	}
+	if err := p.RefreshEntity(&post0); err != acmogo.ErrNotFound {
+		t.Errorf("expected the purged post to be gone but got %v", err)
+	}
+	if err := p.RefreshEntity(&post1); err != nil {
+		t.Errorf("expected the recently trashed post to be kept: %s", err)
+	}
+}
+
+func TestSoftDelete_Inherited(t *testing.T) {
+	p := memstore.New().Persistence()
+	user0 := User{Entity: acmogo.New()}
+	team0 := Team{Entity: acmogo.New()}
+	post0 := Post{Entity: acmogo.New()}
+	team0.PermitDelete(user0)
+	post0.SetParent(team0.Ref())
+	p.InsertList(team0, post0)
+
+	if err := p.SoftDelete(post0, user0); err != nil {
+		t.Fatalf("expected delete to be inherited from the team: %s", err)
+	}
+	var posts []Post
+	if err := p.FindTrash(PostCol, []acmogo.Referencer{user0}, nil, &posts); err != nil || len(posts) != 1 {
+		t.Errorf("expected the trashed post to be found through its parent but got %d (err: %v)", len(posts), err)
+	}
+
+	if err := p.PersistDeny(post0, user0); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Restore(post0, user0); err != acmogo.ErrForbidden {
+		t.Errorf("expected a denied principal to be forbidden but got %v", err)
+	}
+}
+
+func TestRepository_Trashed(t *testing.T) {
+	p := memstore.New().Persistence()
+	user0 := User{Entity: acmogo.New()}
+	post0 := Post{Entity: acmogo.New()}
+	post0.SetCreator(user0.Ref())
+	p.InsertList(post0)
+	if err := p.SoftDelete(post0, user0); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := p.NewRepository(user0)
+	if err := repo.Get(&post0); err != acmogo.ErrNotFound {
+		t.Errorf("expected a trashed entity not to be found by Get but got %v", err)
+	}
+	if err := repo.Update(post0, acmogo.Map{"$set": acmogo.Map{"n": 1}}); err != acmogo.ErrNotFound {
+		t.Errorf("expected a trashed entity not to be found by Update but got %v", err)
+	}
+	if err := repo.Delete(post0); err != acmogo.ErrNotFound {
+		t.Errorf("expected a trashed entity not to be found by Delete but got %v", err)
+	}
+}
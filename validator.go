@@ -0,0 +1,140 @@
+package acmogo
+
+import (
+	"strings"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+)
+
+// The validation levels ApplyValidator accepts. See the collMod command.
+const (
+	ValidationStrict   = "strict"
+	ValidationModerate = "moderate"
+	ValidationOff      = "off"
+)
+
+// ReferenceSchema returns the $jsonSchema of a Reference.
+func ReferenceSchema() Map {
+	return Map{
+		"bsonType":             "object",
+		"required":             []string{"c", "id"},
+		"additionalProperties": false,
+		"properties": Map{
+			"c":  Map{"bsonType": "string", "minLength": 1},
+			"id": Map{"bsonType": "objectId"},
+		},
+	}
+}
+
+// ACSchema returns the $jsonSchema of an AC. It only allows
+// the Grants of the permissions registered when it is called.
+func ACSchema() Map {
+	refs := Map{"bsonType": "array", "items": ReferenceSchema()}
+	grants := Map{}
+	properties := Map{
+		acField(CreatorPath): ReferenceSchema(),
+		acField(PublicPath):  Map{"bsonType": "bool"},
+		acField(DeniedPath):  refs,
+		acField(TimedPath): Map{"bsonType": "array", "items": Map{
+			"bsonType":             "object",
+			"required":             []string{"ref", "p"},
+			"additionalProperties": false,
+			"properties": Map{
+				"ref": ReferenceSchema(),
+				"p":   Map{"enum": Permissions()},
+				"nb":  Map{"bsonType": "date"},
+				"ex":  Map{"bsonType": "date"},
+			},
+		}},
+		acField(GrantsPath): Map{
+			"bsonType":             "object",
+			"additionalProperties": false,
+			"properties":           grants,
+		},
+		acField(NoInheritPath): Map{"bsonType": "bool"},
+	}
+	for _, perm := range Permissions() {
+		if path := perm.Path(); strings.HasPrefix(path, GrantsPath+".") {
+			grants[strings.TrimPrefix(path, GrantsPath+".")] = refs
+		} else {
+			properties[acField(path)] = refs
+		}
+	}
+	return Map{
+		"bsonType":             "object",
+		"additionalProperties": false,
+		"properties":           properties,
+	}
+}
+
+// Validator returns a collection validator checking
+// the AC and parent of the documents of an entity collection.
+func Validator() Map {
+	return Map{"$jsonSchema": Map{
+		"bsonType": "object",
+		"properties": Map{
+			ACPath:     ACSchema(),
+			ParentPath: ReferenceSchema(),
+		},
+	}}
+}
+
+// ApplyValidator sets Validator as the validator of each of collections
+// with the validation level, creating collections that do not exist.
+// It returns the ids of the existing documents of each collection
+// that fail validation.
+func ApplyValidator(db *mgo.Database, level string, collections ...string) (map[string][]bson.ObjectId, error) {
+	validator := Validator()
+	invalid := make(map[string][]bson.ObjectId, len(collections))
+	for _, col := range collections {
+		err := db.Run(bson.D{
+			{Name: "collMod", Value: col},
+			{Name: "validator", Value: validator},
+			{Name: "validationLevel", Value: level},
+		}, nil)
+		if err != nil && isNamespaceNotFound(err) {
+			err = db.Run(bson.D{
+				{Name: "create", Value: col},
+				{Name: "validator", Value: validator},
+				{Name: "validationLevel", Value: level},
+			}, nil)
+		}
+		if err != nil {
+			return invalid, err
+		}
+
+		ids, err := invalidDocuments(db.C(col), validator)
+		if err != nil {
+			return invalid, err
+		}
+		if len(ids) > 0 {
+			invalid[col] = ids
+		}
+	}
+	return invalid, nil
+}
+
+// InvalidDocuments returns the ids of the documents in col failing Validator.
+func InvalidDocuments(db *mgo.Database, col string) ([]bson.ObjectId, error) {
+	return invalidDocuments(db.C(col), Validator())
+}
+
+func invalidDocuments(c *mgo.Collection, validator Map) ([]bson.ObjectId, error) {
+	var docs []struct {
+		ID bson.ObjectId `bson:"_id"`
+	}
+	if err := c.Find(Map{"$nor": []Map{validator}}).Select(Map{"_id": 1}).All(&docs); err != nil {
+		return nil, err
+	}
+	ids := make([]bson.ObjectId, 0, len(docs))
+	for _, doc := range docs {
+		ids = append(ids, doc.ID)
+	}
+	return ids, nil
+}
+
+// acField returns the name of the field of the AC subdocument stored at path.
+func acField(path string) string {
+	return strings.TrimPrefix(path, ACPath+".")
+}
@@ -0,0 +1,58 @@
+package acmogo_test
+
+import (
+	"testing"
+
+	"github.com/crhntr/acmogo"
+	"github.com/globalsign/mgo/bson"
+)
+
+func TestACSchema(t *testing.T) {
+	properties := acmogo.ACSchema()["properties"].(acmogo.Map)
+	for _, field := range []string{"r", "u", "d", "cr", "pu", "g", "t", "dn", "ni"} {
+		if _, ok := properties[field]; !ok {
+			t.Errorf("expected the schema to describe %q", field)
+		}
+	}
+	if _, ok := properties["p"]; ok {
+		t.Error("expected the schema not to allow p")
+	}
+	grants := properties["g"].(acmogo.Map)["properties"].(acmogo.Map)
+	if _, ok := grants[string(Comment)]; !ok {
+		t.Errorf("expected the schema to allow grants of registered permissions but got %v", grants)
+	}
+}
+
+func TestApplyValidator(t *testing.T) {
+	requireDB(t)
+	dropCollections(PostCol, TeamCol)
+	defer dropCollections(PostCol, TeamCol)
+
+	user0 := User{Entity: acmogo.New()}
+	post0 := Post{Entity: acmogo.New()}
+	post0.PermitRead(user0)
+	acmogo.InsertList(db, post0)
+
+	stray := bson.NewObjectId()
+	db.C(PostCol).Insert(mp{"_id": stray, "_ac": mp{"p": true}})
+	noCol := bson.NewObjectId()
+	db.C(PostCol).Insert(mp{"_id": noCol, "_ac": mp{"r": []mp{{"id": user0.ID}}}})
+
+	invalid, err := acmogo.ApplyValidator(db, acmogo.ValidationModerate, PostCol, TeamCol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := invalid[PostCol]; len(ids) != 2 || ids[0] != stray && ids[1] != stray {
+		t.Errorf("expected the two malformed posts to be reported but got %v", ids)
+	}
+	if _, ok := invalid[TeamCol]; ok {
+		t.Errorf("expected no invalid teams but got %v", invalid[TeamCol])
+	}
+
+	if err := acmogo.PersistPublic(db, post0); err != nil {
+		t.Errorf("expected a valid change to be accepted: %s", err)
+	}
+	if err := db.C(PostCol).Insert(mp{"_id": bson.NewObjectId(), "_ac": mp{"r": "user0"}}); err == nil {
+		t.Error("expected a malformed insert to be rejected")
+	}
+}
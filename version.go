@@ -0,0 +1,134 @@
+package acmogo
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+)
+
+// ErrConflict is returned by UpdateEntityVersion when the stored
+// entity was updated after the caller loaded it.
+var ErrConflict = errors.New("entity was updated concurrently")
+
+// UpdateEntityVersion applies updateDoc to the stored entity only if its
+// Version is still version, incrementing Version and setting UpdatedAt
+// in the same update. It returns ErrConflict if the entity exists
+// but has another version and ErrNotFound if it does not exist.
+func UpdateEntityVersion(db *mgo.Database, entity Referencer, version int, updateDoc Map) error {
+	return mgoPersistence(db).UpdateEntityVersion(entity, version, updateDoc)
+}
+
+func (p Persistence) UpdateEntityVersion(entity Referencer, version int, updateDoc Map) error {
+	ref := entity.Ref()
+	stamped, err := stampUpdateDoc(updateDoc, version)
+	if err != nil {
+		return err
+	}
+	err = p.update(ref, Map{"_id": ref.ID, VersionPath: versionSelector(version)}, stamped)
+	return p.selectorErr(ref, err, ErrConflict)
+}
+
+// versionSelector matches the documents with version.
+func versionSelector(version int) interface{} {
+	if version == 0 {
+		// documents stored before versioning have no version field
+		return Map{"$in": []interface{}{0, nil}}
+	}
+	return version
+}
+
+// updateStamped applies the stamped updateDoc to the entity ref if it
+// matches selector. A replacement document is stamped with the version
+// stored before it and only replaces that version; ErrConflict is
+// returned if another update got there first.
+func (p Persistence) updateStamped(ref Reference, selector, updateDoc Map) error {
+	if hasOperators(updateDoc) {
+		stamped, err := stampUpdateDoc(updateDoc, 0)
+		if err != nil {
+			return err
+		}
+		return p.update(ref, andFilter(Map{"_id": ref.ID}, selector), stamped)
+	}
+	version, err := p.storedVersion(ref)
+	if err != nil {
+		return err
+	}
+	stamped, err := stampUpdateDoc(updateDoc, version)
+	if err != nil {
+		return err
+	}
+	err = p.update(ref, andFilter(Map{"_id": ref.ID, VersionPath: versionSelector(version)}, selector), stamped)
+	if err == ErrNotFound {
+		if current, cerr := p.storedVersion(ref); cerr == nil && current != version {
+			return ErrConflict
+		}
+	}
+	return err
+}
+
+func (p Persistence) storedVersion(ref Reference) (int, error) {
+	var ent Entity
+	err := p.Store.FindId(ref.Col, ref.ID, Map{VersionPath: 1}, &ent)
+	return ent.Version, err
+}
+
+// stampUpdateDoc returns a copy of updateDoc that also increments the
+// version and sets the update time. A replacement document, which has
+// no update operators, is given version+1 as its version.
+func stampUpdateDoc(updateDoc Map, version int) (Map, error) {
+	if !hasOperators(updateDoc) {
+		stamped, err := withField(updateDoc, UpdatedAtPath, Now())
+		if err == nil {
+			stamped[VersionPath] = version + 1
+		}
+		return stamped, err
+	}
+	stamped := make(Map, len(updateDoc)+2)
+	for key, value := range updateDoc {
+		stamped[key] = value
+	}
+	var err error
+	if stamped["$set"], err = withField(updateDoc["$set"], UpdatedAtPath, Now()); err != nil {
+		return nil, err
+	}
+	if stamped["$inc"], err = withField(updateDoc["$inc"], VersionPath, 1); err != nil {
+		return nil, err
+	}
+	return stamped, nil
+}
+
+func hasOperators(updateDoc Map) bool {
+	for key := range updateDoc {
+		if strings.HasPrefix(key, "$") {
+			return true
+		}
+	}
+	return false
+}
+
+// withField returns a copy of the document doc with key set to value.
+// doc may be nil, a map with string keys or a bson.D.
+func withField(doc interface{}, key string, value interface{}) (Map, error) {
+	fields := Map{}
+	switch doc := doc.(type) {
+	case nil:
+	case bson.D:
+		for _, elem := range doc {
+			fields[elem.Name] = elem.Value
+		}
+	default:
+		v := reflect.ValueOf(doc)
+		if v.Kind() != reflect.Map || v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("acmogo: cannot add %s to an update document of type %T", key, doc)
+		}
+		for _, k := range v.MapKeys() {
+			fields[k.String()] = v.MapIndex(k).Interface()
+		}
+	}
+	fields[key] = value
+	return fields, nil
+}
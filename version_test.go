@@ -0,0 +1,101 @@
+package acmogo_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/crhntr/acmogo"
+	"github.com/crhntr/acmogo/memstore"
+	"github.com/globalsign/mgo/bson"
+)
+
+func TestUpdateEntityVersion(t *testing.T) {
+	updated := time.Date(2019, time.March, 1, 12, 0, 0, 0, time.UTC)
+	now := acmogo.Now
+	defer func() { acmogo.Now = now }()
+	acmogo.Now = func() time.Time { return updated }
+
+	store := memstore.New()
+	p := store.Persistence()
+	post0 := Post{Entity: acmogo.New()}
+	post1 := Post{Entity: acmogo.New()}
+	p.InsertList(post0)
+
+	if err := p.UpdateEntityVersion(post0, post0.Version, acmogo.Map{"$set": acmogo.Map{"n": 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.UpdateEntityVersion(post0, post0.Version, acmogo.Map{"$set": acmogo.Map{"n": 2}}); err != acmogo.ErrConflict {
+		t.Errorf("expected a conflict but got %v", err)
+	}
+	if err := p.UpdateEntityVersion(post1, 0, acmogo.Map{"$set": acmogo.Map{"n": 2}}); err != acmogo.ErrNotFound {
+		t.Errorf("expected not found but got %v", err)
+	}
+
+	p.RefreshEntity(&post0)
+	if post0.N != 1 || post0.Version != 1 || !post0.UpdatedAt.Equal(updated) {
+		t.Errorf("expected the first update to be applied and stamped but got %+v", post0)
+	}
+
+	if err := p.UpdateEntity(post0, acmogo.Map{"$inc": acmogo.Map{"n": 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.UpdateEntityVersion(post0, 1, acmogo.Map{"$set": acmogo.Map{"n": 0}}); err != acmogo.ErrConflict {
+		t.Errorf("expected UpdateEntity to bump the version but got %v", err)
+	}
+
+	// documents stored before versioning
+	legacy := bson.NewObjectId()
+	store.Insert(PostCol, acmogo.Map{"_id": legacy})
+	if err := p.UpdateEntityVersion(acmogo.Reference{Col: PostCol, ID: legacy}, 0, acmogo.Map{"$set": acmogo.Map{"n": 1}}); err != nil {
+		t.Errorf("expected an unversioned document to match version 0: %s", err)
+	}
+}
+
+func TestUpdateEntity_Stamped(t *testing.T) {
+	updated := time.Date(2019, time.March, 1, 12, 0, 0, 0, time.UTC)
+	now := acmogo.Now
+	defer func() { acmogo.Now = now }()
+	acmogo.Now = func() time.Time { return updated }
+
+	p := memstore.New().Persistence()
+	post0 := Post{Entity: acmogo.New()}
+	p.InsertList(post0)
+
+	if err := p.UpdateEntity(post0, acmogo.Map{"$set": bson.D{{Name: "n", Value: 1}}}); err != nil {
+		t.Fatal(err)
+	}
+	p.RefreshEntity(&post0)
+	if post0.N != 1 || post0.Version != 1 || !post0.UpdatedAt.Equal(updated) {
+		t.Errorf("expected a bson.D update to be applied and stamped but got %+v", post0)
+	}
+
+	replacement := acmogo.Map{"_ac": post0.AC, "n": 2}
+	if err := p.UpdateEntity(post0, replacement); err != nil {
+		t.Fatal(err)
+	}
+	p.RefreshEntity(&post0)
+	if post0.N != 2 || post0.Version != 2 {
+		t.Errorf("expected the replacement to be stamped but got %+v", post0)
+	}
+	if err := p.UpdateEntityVersion(post0, 2, acmogo.Map{"n": 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.UpdateEntityVersion(post0, 2, acmogo.Map{"n": 4}); err != acmogo.ErrConflict {
+		t.Errorf("expected the stamped replacement to conflict but got %v", err)
+	}
+
+	// an update made between reading the version and replacing
+	store := &staleReads{Store: memstore.New()}
+	p = acmogo.Persistence{Store: store}
+	p.InsertList(post0)
+	store.invalidate = func() {
+		p.UpdateEntity(post0, acmogo.Map{"$inc": acmogo.Map{"n": 1}})
+	}
+	if err := p.UpdateEntity(post0, acmogo.Map{"n": 5}); err != acmogo.ErrConflict {
+		t.Errorf("expected the replacement to conflict but got %v", err)
+	}
+
+	if err := p.UpdateEntity(post0, acmogo.Map{"$set": []string{"n"}}); err == nil {
+		t.Error("expected a malformed $set to be rejected")
+	}
+}